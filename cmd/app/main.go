@@ -8,6 +8,7 @@ package main
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.basic BasicAuth
 
 import (
 	"context"
@@ -22,6 +23,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
@@ -63,25 +65,119 @@ func main() {
 
 	// Репозиторий
 	authRepo := postgres.NewRefreshTokenRepository(db)
+	roleRepo := postgres.NewUserRoleRepository(db)
+	userRepo := postgres.NewUserRepository(db)
+	oneTimeTokenRepo := postgres.NewOneTimeTokenRepository(db)
+	mfaRepo := postgres.NewMFARepository(db)
+	webAuthnRepo := postgres.NewWebAuthnRepository(db)
+	oauthRepo := postgres.NewOAuthRepository(db)
 
 	// PKG
-	tokenManager := jwt.NewTokenManager(cfg.JWT.SecretKey, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+	signingKey := jwt.NewHMACKey(cfg.JWT.SecretKey)
+	if !cfg.JWT.IsSymmetric() {
+		signingKey, err = jwt.LoadSigningKey(cfg.JWT.SigningMethod, cfg.JWT.PrivateKeyPath)
+		if err != nil {
+			slog.Error(op, "не удалось загрузить ключ подписи", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+	keyring := jwt.NewKeyring(signingKey)
+	// Токены, подписанные общим секретом до перехода на асимметричный алгоритм, проверяются
+	// только до JWT_LEGACY_HS512_UNTIL, после чего секрет выводится из связки
+	if !cfg.JWT.IsSymmetric() && !cfg.JWT.LegacyHS512Until.IsZero() {
+		keyring.AddUntil(jwt.NewHMACKey(cfg.JWT.SecretKey), cfg.JWT.LegacyHS512Until)
+	}
+	for _, keyFile := range cfg.JWT.VerifyKeys {
+		verifyKey, err := jwt.LoadSigningKey(keyFile.Method, keyFile.Path)
+		if err != nil {
+			slog.Error(op, "не удалось загрузить ключ проверки", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		keyring.Add(verifyKey)
+	}
+	tokenManager := jwt.NewTokenManager(keyring, jwt.Options{
+		AccessTTL:     cfg.JWT.AccessTTL,
+		RefreshTTL:    cfg.JWT.RefreshTTL,
+		Pepper:        cfg.JWT.RefreshPepper,
+		RefreshFormat: cfg.JWT.RefreshFormat,
+		Issuer:        cfg.JWT.Issuer,
+		Audience:      cfg.JWT.Audience,
+		Leeway:        cfg.JWT.Leeway,
+	})
 	smtpManager := smtp.NewEmailSender(&cfg.SMTP)
 
 	// UseCase
-	authUseCase := usecase.NewAuthUseCase(tokenManager, authRepo, smtpManager)
+	claimsProvider := usecase.NewRoleClaimsProvider(roleRepo, cfg.Scopes)
+	authUseCase := usecase.NewAuthUseCase(tokenManager, authRepo, smtpManager, claimsProvider, mfaRepo, cfg.Session, cfg.MFA)
+	userUseCase, err := usecase.NewUserUseCase(userRepo, oneTimeTokenRepo, authUseCase, smtpManager, cfg.ServerConfig.BaseURL, cfg.Verification)
+	if err != nil {
+		slog.Error(op, "не удалось инициализировать пользователей", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	mfaUseCase := usecase.NewMFAUseCase(mfaRepo, userRepo, tokenManager, authUseCase, cfg.MFA)
+	webAuthnUseCase, err := usecase.NewWebAuthnUseCase(webAuthnRepo, userRepo, mfaRepo, authUseCase, cfg.WebAuthn, cfg.Verification)
+	if err != nil {
+		slog.Error(op, "не удалось инициализировать WebAuthn", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	oauthUseCase := usecase.NewOAuthUseCase(oauthRepo, mfaRepo, claimsProvider, authUseCase, tokenManager, cfg.OAuth)
 
 	// Handler
 	authHandler := handler.NewAuthHandler(authUseCase)
+	userHandler := handler.NewUserHandler(userUseCase)
+	sessionHandler := handler.NewSessionHandler(authUseCase)
+	mfaHandler := handler.NewMFAHandler(mfaUseCase)
+	webAuthnHandler := handler.NewWebAuthnHandler(webAuthnUseCase)
+	oauthHandler := handler.NewOAuthHandler(oauthUseCase, cfg.OAuth.ConsentURL)
+	keysHandler := handler.NewKeysHandler(tokenManager)
 
 	r := gin.Default()
 
-	http.SetupRoutes(r, authHandler)
+	http.SetupRoutes(r, cfg, authUseCase, authHandler, userHandler, sessionHandler, mfaHandler, webAuthnHandler, oauthHandler, keysHandler)
 
 	// Graceful shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Периодическая очистка истёкших сессий, надгробий и одноразовых токенов.
+	// Задачи независимы: ошибка одной не отменяет остальные
+	cleanups := []struct {
+		target string
+		run    func(context.Context) (int64, error)
+	}{
+		{"истёкшие сессии", authRepo.DeleteExpiredSessions},
+		{"истёкшие одноразовые токены", oneTimeTokenRepo.DeleteExpiredOneTimeTokens},
+		{"погашенные токены MFA challenge", mfaRepo.DeleteExpiredMFAChallenges},
+		{"брошенные церемонии WebAuthn", webAuthnRepo.DeleteExpiredWebAuthnCeremonies},
+		{"истёкшие коды авторизации OAuth", oauthRepo.DeleteExpiredAuthorizationCodes},
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, cleanup := range cleanups {
+					count, err := cleanup.run(ctx)
+					if err != nil {
+						slog.Error(op, "ошибка периодической очистки",
+							slog.String("target", cleanup.target),
+							slog.String("error", err.Error()),
+						)
+						continue
+					}
+					slog.Debug(op, "периодическая очистка",
+						slog.String("target", cleanup.target),
+						slog.Int64("count", count),
+					)
+				}
+			}
+		}
+	}()
+
 	go func() {
 		if err = r.Run(":" + cfg.ServerConfig.Address); err != nil {
 			slog.Error(op, "ошибка при старте сервера", slog.String("error", err.Error()))
@@ -90,5 +186,5 @@ func main() {
 	}()
 
 	<-ctx.Done()
-	slog.Info(op, "остановка сервера...")
+	slog.Info("остановка сервера...", slog.String("op", op))
 }
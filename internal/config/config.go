@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,34 +13,133 @@ import (
 )
 
 type Config struct {
-	ServerConfig ServerConfig
-	Postgres     Postgres
-	Log          LogConfig
-	JWT          JWT
-	SMTP         SMTPConfig
-	Env          string
+	ServerConfig  ServerConfig
+	Admin         AdminConfig
+	Introspection IntrospectionConfig
+	Postgres      Postgres
+	Log           LogConfig
+	JWT           JWT
+	Session       SessionConfig
+	Scopes        ScopeConfig
+	Verification  VerificationConfig
+	MFA           MFAConfig
+	WebAuthn      WebAuthnConfig
+	OAuth         OAuthConfig
+	SMTP          SMTPConfig
+	Env           string
+}
+
+// Секреты по умолчанию известны всем и допустимы только в окружении development
+const (
+	defaultJWTSecretKey     = "my_secret_key"
+	defaultRefreshPepper    = "my_refresh_pepper"
+	defaultMFAEncryptionKey = "my_mfa_encryption_key"
+)
+
+type ScopeConfig struct {
+	Default []string            // scopes, доступные любому пользователю
+	ByRole  map[string][]string // роль -> дополнительные scopes
+}
+
+// Политика входа с неподтверждённым email
+const (
+	UnverifiedLoginRestrict = "restrict" // выдавать токены только со scopes UnverifiedScopes
+	UnverifiedLoginBlock    = "block"    // не пускать до подтверждения
+)
+
+type VerificationConfig struct {
+	TTL               time.Duration // срок действия ссылки подтверждения
+	ResendCooldown    time.Duration // минимальный интервал между письмами одному пользователю
+	ResendPerHour     int           // максимум писем одному пользователю в час
+	UnverifiedLogin   string        // restrict или block
+	UnverifiedScopes  []string      // scopes, доступные до подтверждения email
+	PasswordResetTTL  time.Duration // срок действия ссылки сброса пароля
+	PasswordResetURL  string        // страница сброса пароля, токен передаётся в ?token=
+	MagicLinkTTL      time.Duration // срок действия ссылки и кода для входа без пароля
+	MagicLinkURL      string        // страница входа по ссылке, токен передаётся в ?token=
+	MagicLinkAttempts int           // попыток ввода кода из письма
+}
+
+type MFAConfig struct {
+	Issuer        string        // название сервиса в приложении-аутентификаторе
+	EncryptionKey string        // ключ шифрования секретов TOTP в БД
+	ChallengeTTL  time.Duration // срок действия токена MFA challenge
+	MaxAttempts   int           // неверных кодов подряд до временной блокировки
+	Lockout       time.Duration // длительность блокировки после MaxAttempts неверных кодов
+}
+
+type WebAuthnConfig struct {
+	RPID         string        // домен, к которому привязываются ключи доступа (по умолчанию хост APP_BASE_URL)
+	RPName       string        // название сервиса, которое показывает браузер
+	Origins      []string      // адреса страниц, с которых разрешены церемонии (по умолчанию APP_BASE_URL)
+	CeremonyTTL  time.Duration // сколько действует начатая регистрация ключа или вход по ключу
+	ReauthMaxAge time.Duration // насколько недавним должен быть вход, чтобы зарегистрировать ключ доступа
+}
+
+type OAuthConfig struct {
+	ConsentURL string        // страница согласия, на которую /oauth/authorize перенаправляет с параметрами запроса
+	CodeTTL    time.Duration // срок действия кода авторизации
+}
+
+type SessionConfig struct {
+	MaxPerUser int // максимум одновременных сессий (устройств) на пользователя
+
+	// Сколько после ротации погашенный refresh токен, предъявленный с того же IP,
+	// возвращает уже выданную пару преемника вместо срабатывания защиты от повтора. 0 - отключено
+	RefreshGracePeriod time.Duration
 }
 
 type SMTPConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
-	From     string
-	UseTLS   bool
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	From      string
+	UseTLS    bool
+	DebugBody bool // без настроенного SMTP печатать тело письма в stdout, только для development
 }
 
 type ServerConfig struct {
 	Address     string
+	BaseURL     string // публичный адрес сервиса для ссылок в письмах
 	Timeout     time.Duration
 	IdleTimeout time.Duration
 }
 
 type JWT struct {
-	SecretKey     string
-	AccessTTL     time.Duration
-	RefreshTTL    time.Duration
-	SigningMethod string
+	SecretKey        string // общий секрет HS512, при асимметричном алгоритме - ключ проверки прежних токенов
+	AccessTTL        time.Duration
+	RefreshTTL       time.Duration
+	SigningMethod    string
+	PrivateKeyPath   string // PEM с приватным ключом для RS*/PS*/ES*/EdDSA
+	VerifyKeys       []KeyFile
+	RefreshPepper    string // серверный секрет для HMAC хеша refresh токенов
+	RefreshFormat    string // jwt или opaque
+	Issuer           string
+	Audience         string
+	Leeway           time.Duration // допустимое расхождение часов
+	LegacyHS512Until time.Time     // до какого момента JWT_SECRET_KEY проверяет прежние токены при асимметричном алгоритме
+}
+
+// KeyFile - дополнительный ключ связки в формате ALG:path.
+// Приватный ключ можно сделать активным при ротации, публичный только проверяет подпись
+type KeyFile struct {
+	Method string
+	Path   string
+}
+
+type IntrospectionConfig struct {
+	Clients map[string]string // client_id -> client_secret
+}
+
+type AdminConfig struct {
+	APIKey string // пустой ключ отключает административные маршруты
+}
+
+// IsSymmetric сообщает, подписываются ли токены общим секретом JWT_SECRET_KEY
+func (j *JWT) IsSymmetric() bool {
+	method := strings.ToUpper(j.SigningMethod)
+	return method == "HS512" || method == "SHA512"
 }
 
 type Postgres struct {
@@ -91,26 +191,92 @@ func InitConfig() (*Config, error) {
 		return dur
 	}
 
+	parseTime := func(envKey string) time.Time {
+		value := getEnv(envKey, "")
+		if value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			panic(fmt.Sprintf("невалидное время %s (ожидается RFC 3339): %v", envKey, err))
+		}
+		return t
+	}
+
 	cfg := &Config{
 		Env: getEnv("ENV", "development"),
 		ServerConfig: ServerConfig{
 			Address:     getEnv("HTTP_SERVER_ADDRESS", "8080"),
+			BaseURL:     strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:8080"), "/"),
 			Timeout:     parseDuration("HTTP_SERVER_TIMEOUT", "5s"),
 			IdleTimeout: parseDuration("HTTP_SERVER_IDLE_TIMEOUT", "60s"),
 		},
 		JWT: JWT{
-			SecretKey:     getEnv("JWT_SECRET_KEY", "my_secret_key"),
-			AccessTTL:     parseDuration("JWT_ACCESS_TTL", "15m"),
-			RefreshTTL:    parseDuration("JWT_REFRESH_TTL", "24h"),
-			SigningMethod: getEnv("JWT_SIGNING_METHOD", "SHA512"),
+			SecretKey:        getEnv("JWT_SECRET_KEY", ""),
+			AccessTTL:        parseDuration("JWT_ACCESS_TTL", "15m"),
+			RefreshTTL:       parseDuration("JWT_REFRESH_TTL", "24h"),
+			SigningMethod:    getEnv("JWT_SIGNING_METHOD", "HS512"),
+			PrivateKeyPath:   getPath(rootDir, "JWT_PRIVATE_KEY_PATH", ""),
+			VerifyKeys:       parseKeyFiles(rootDir, getEnv("JWT_VERIFY_KEYS", "")),
+			RefreshPepper:    getEnv("REFRESH_TOKEN_PEPPER", defaultRefreshPepper),
+			RefreshFormat:    strings.ToLower(getEnv("REFRESH_TOKEN_FORMAT", "jwt")),
+			Issuer:           getEnv("JWT_ISSUER", "auth-service"),
+			Audience:         getEnv("JWT_AUDIENCE", ""),
+			Leeway:           parseDuration("JWT_LEEWAY", "30s"),
+			LegacyHS512Until: parseTime("JWT_LEGACY_HS512_UNTIL"),
+		},
+		Admin: AdminConfig{
+			APIKey: getEnv("ADMIN_API_KEY", ""),
+		},
+		Introspection: IntrospectionConfig{
+			Clients: parseClients(getEnv("INTROSPECTION_CLIENTS", "")),
+		},
+		Session: SessionConfig{
+			MaxPerUser:         getEnvAsInt("SESSION_MAX_PER_USER", 5),
+			RefreshGracePeriod: parseDuration("REFRESH_GRACE_PERIOD", "10s"),
+		},
+		Scopes: ScopeConfig{
+			Default: strings.Fields(getEnv("AUTH_DEFAULT_SCOPES", "profile sessions")),
+			ByRole:  parseRoleScopes(getEnv("AUTH_ROLE_SCOPES", "")),
+		},
+		Verification: VerificationConfig{
+			TTL:               parseDuration("EMAIL_VERIFICATION_TTL", "24h"),
+			ResendCooldown:    parseDuration("EMAIL_VERIFICATION_RESEND_COOLDOWN", "1m"),
+			ResendPerHour:     getEnvAsInt("EMAIL_VERIFICATION_RESEND_PER_HOUR", 5),
+			UnverifiedLogin:   strings.ToLower(getEnv("UNVERIFIED_LOGIN", UnverifiedLoginRestrict)),
+			UnverifiedScopes:  strings.Fields(getEnv("UNVERIFIED_SCOPES", "profile")),
+			PasswordResetTTL:  parseDuration("PASSWORD_RESET_TTL", "30m"),
+			PasswordResetURL:  getEnv("PASSWORD_RESET_URL", ""),
+			MagicLinkTTL:      parseDuration("MAGIC_LINK_TTL", "15m"),
+			MagicLinkURL:      getEnv("MAGIC_LINK_URL", ""),
+			MagicLinkAttempts: getEnvAsInt("MAGIC_LINK_ATTEMPTS", 5),
+		},
+		MFA: MFAConfig{
+			Issuer:        getEnv("TOTP_ISSUER", "Auth Service"),
+			EncryptionKey: getEnv("MFA_ENCRYPTION_KEY", defaultMFAEncryptionKey),
+			ChallengeTTL:  parseDuration("MFA_CHALLENGE_TTL", "5m"),
+			MaxAttempts:   getEnvAsInt("MFA_MAX_ATTEMPTS", 5),
+			Lockout:       parseDuration("MFA_LOCKOUT", "15m"),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:         getEnv("WEBAUTHN_RP_ID", ""),
+			RPName:       getEnv("WEBAUTHN_RP_NAME", "Auth Service"),
+			Origins:      parseList(getEnv("WEBAUTHN_ORIGINS", "")),
+			CeremonyTTL:  parseDuration("WEBAUTHN_CEREMONY_TTL", "5m"),
+			ReauthMaxAge: parseDuration("WEBAUTHN_REAUTH_MAX_AGE", "5m"),
+		},
+		OAuth: OAuthConfig{
+			ConsentURL: getEnv("OAUTH_CONSENT_URL", ""),
+			CodeTTL:    parseDuration("OAUTH_CODE_TTL", "1m"),
 		},
 		SMTP: SMTPConfig{
-			Host:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-			Port:     getEnvAsInt("SMTP_PORT", 587),
-			Username: getEnv("SMTP_USERNAME", ""),
-			Password: getEnv("SMTP_PASSWORD", ""),
-			From:     getEnv("SMTP_FROM", ""),
-			UseTLS:   getEnv("SMTP_USE_TLS", "true") == "true",
+			Host:      getEnv("SMTP_HOST", "smtp.gmail.com"),
+			Port:      getEnvAsInt("SMTP_PORT", 587),
+			Username:  getEnv("SMTP_USERNAME", ""),
+			Password:  getEnv("SMTP_PASSWORD", ""),
+			From:      getEnv("SMTP_FROM", ""),
+			UseTLS:    getEnv("SMTP_USE_TLS", "true") == "true",
+			DebugBody: getEnv("SMTP_DEBUG_BODY", "false") == "true",
 		},
 		Postgres: Postgres{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -126,6 +292,33 @@ func InitConfig() (*Config, error) {
 		},
 	}
 
+	// Секрет по умолчанию нужен только для подписи HS512. При асимметричном алгоритме заданный
+	// JWT_SECRET_KEY проверяет токены, выпущенные общим секретом до перехода, до JWT_LEGACY_HS512_UNTIL
+	if cfg.JWT.SecretKey == "" && cfg.JWT.IsSymmetric() {
+		cfg.JWT.SecretKey = defaultJWTSecretKey
+	}
+
+	// По умолчанию ссылки сброса пароля, входа и страница согласия OAuth - на страницах сервиса
+	if cfg.Verification.PasswordResetURL == "" {
+		cfg.Verification.PasswordResetURL = cfg.ServerConfig.BaseURL + "/reset-password"
+	}
+	if cfg.Verification.MagicLinkURL == "" {
+		cfg.Verification.MagicLinkURL = cfg.ServerConfig.BaseURL + "/magic-link"
+	}
+	if cfg.OAuth.ConsentURL == "" {
+		cfg.OAuth.ConsentURL = cfg.ServerConfig.BaseURL + "/oauth/consent"
+	}
+
+	// По умолчанию ключи доступа привязываются к публичному адресу сервиса
+	if len(cfg.WebAuthn.Origins) == 0 {
+		cfg.WebAuthn.Origins = []string{cfg.ServerConfig.BaseURL}
+	}
+	if cfg.WebAuthn.RPID == "" {
+		if baseURL, err := url.Parse(cfg.ServerConfig.BaseURL); err == nil {
+			cfg.WebAuthn.RPID = baseURL.Hostname()
+		}
+	}
+
 	if err = cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -143,13 +336,49 @@ func (c *Config) Validate() error {
 	if c.Postgres.User == "" {
 		return fmt.Errorf("имя пользователя базы данных не может быть пустым")
 	}
+	if c.JWT.RefreshFormat != "jwt" && c.JWT.RefreshFormat != "opaque" {
+		return fmt.Errorf("недопустимый формат refresh токена: %s", c.JWT.RefreshFormat)
+	}
+	if c.Session.MaxPerUser <= 0 {
+		return fmt.Errorf("лимит сессий на пользователя должен быть положительным")
+	}
+	if c.Verification.UnverifiedLogin != UnverifiedLoginRestrict && c.Verification.UnverifiedLogin != UnverifiedLoginBlock {
+		return fmt.Errorf("недопустимое значение UNVERIFIED_LOGIN: %s", c.Verification.UnverifiedLogin)
+	}
+	if c.Verification.MagicLinkAttempts <= 0 {
+		return fmt.Errorf("число попыток ввода кода из письма должно быть положительным")
+	}
+	if c.MFA.MaxAttempts <= 0 {
+		return fmt.Errorf("число попыток ввода кода MFA должно быть положительным")
+	}
+	if c.WebAuthn.RPID == "" {
+		return fmt.Errorf("не удалось определить WEBAUTHN_RP_ID")
+	}
 	if c.ServerConfig.Address == "" {
 		return fmt.Errorf("адрес сервера не может быть пустым")
 	}
+	if !c.JWT.IsSymmetric() && c.JWT.PrivateKeyPath == "" {
+		return fmt.Errorf("для алгоритма %s необходимо указать JWT_PRIVATE_KEY_PATH", c.JWT.SigningMethod)
+	}
+	if !c.JWT.IsSymmetric() && !c.JWT.LegacyHS512Until.IsZero() && c.JWT.SecretKey == "" {
+		return fmt.Errorf("для JWT_LEGACY_HS512_UNTIL необходимо указать JWT_SECRET_KEY")
+	}
 	validEnvs := map[string]bool{"development": true, "production": true, "test": true}
 	if !validEnvs[strings.ToLower(c.Env)] {
 		return fmt.Errorf("недопустимое окружение: %s", c.Env)
 	}
+	if !strings.EqualFold(c.Env, "development") {
+		switch {
+		case c.JWT.SecretKey == defaultJWTSecretKey:
+			return fmt.Errorf("JWT_SECRET_KEY не задан: секрет по умолчанию допустим только в окружении development")
+		case c.JWT.RefreshPepper == defaultRefreshPepper:
+			return fmt.Errorf("REFRESH_TOKEN_PEPPER не задан: секрет по умолчанию допустим только в окружении development")
+		case c.MFA.EncryptionKey == defaultMFAEncryptionKey:
+			return fmt.Errorf("MFA_ENCRYPTION_KEY не задан: секрет по умолчанию допустим только в окружении development")
+		case c.SMTP.DebugBody:
+			return fmt.Errorf("SMTP_DEBUG_BODY допустим только в окружении development")
+		}
+	}
 	return nil
 }
 
@@ -165,6 +394,68 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getPath читает путь из окружения, относительные пути считаются от корня проекта
+func getPath(rootDir, key, defaultValue string) string {
+	path := getEnv(key, defaultValue)
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(rootDir, path)
+}
+
+// parseKeyFiles разбирает список вида "ES256:keys/old.pem,RS256:keys/older.pub.pem"
+func parseKeyFiles(rootDir, value string) []KeyFile {
+	var files []KeyFile
+	for _, item := range strings.Split(value, ",") {
+		method, path, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(rootDir, path)
+		}
+		files = append(files, KeyFile{Method: method, Path: path})
+	}
+	return files
+}
+
+// parseClients разбирает список учётных данных клиентов вида "id:secret,id2:secret2"
+func parseClients(value string) map[string]string {
+	clients := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || id == "" || secret == "" {
+			continue
+		}
+		clients[id] = secret
+	}
+	return clients
+}
+
+// parseList разбирает список значений через запятую
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRoleScopes разбирает список вида "admin=users:read users:write;support=users:read"
+func parseRoleScopes(value string) map[string][]string {
+	roleScopes := make(map[string][]string)
+	for _, item := range strings.Split(value, ";") {
+		role, scopes, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || role == "" {
+			continue
+		}
+		roleScopes[role] = strings.Fields(scopes)
+	}
+	return roleScopes
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		var i int
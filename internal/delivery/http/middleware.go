@@ -0,0 +1,66 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/medods/auth-service/pkg/authmw"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// AccessTokenVerifier проверяет access токен вместе с его сессией
+type AccessTokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*jwt.TokenClaims, error)
+}
+
+// sessionIntrospector - authmw.Introspector для собственных маршрутов сервиса. Проверка подписи
+// не видит отзыва, поэтому каждый токен сверяется с его сессией в базе, как при интроспекции
+type sessionIntrospector struct {
+	verifier AccessTokenVerifier
+}
+
+func (i sessionIntrospector) Introspect(ctx context.Context, token string) (*jwt.TokenClaims, error) {
+	claims, err := i.verifier.VerifyAccessToken(ctx, token)
+	switch {
+	case err == nil:
+		return claims, nil
+	case errors.Is(err, jwt.ErrInvalidToken), errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, jwt.ErrNotAccessToken):
+		return nil, err
+	default:
+		return nil, fmt.Errorf("%w: %v", authmw.ErrIntrospectionFailed, err)
+	}
+}
+
+// adminAuth пропускает запросы с административным ключом в заголовке X-Admin-Key
+func adminAuth(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "неверный административный ключ"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// firstPartyOnly пропускает только access токены собственных приложений сервиса. Токен, выданный
+// стороннему OAuth клиенту, не должен управлять входом пользователя: иначе клиент мог бы
+// зарегистрировать свой ключ доступа или отключить второй фактор и завладеть аккаунтом.
+// Ставится после authmw.RequireToken
+func firstPartyOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authmw.Claims(c)
+		if !ok || claims.ClientID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":             "access_denied",
+				"error_description": "маршрут доступен только токену собственного приложения сервиса",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -3,20 +3,101 @@ package http
 import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/medods/auth-service/internal/config"
 	"github.com/medods/auth-service/internal/handler"
+	"github.com/medods/auth-service/pkg/authmw"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 // SetupRoutes настраивает маршруты
-func SetupRoutes(r *gin.Engine, authHandler *handler.AuthHandler) {
+func SetupRoutes(
+	r *gin.Engine,
+	cfg *config.Config,
+	tokenVerifier AccessTokenVerifier,
+	authHandler *handler.AuthHandler,
+	userHandler *handler.UserHandler,
+	sessionHandler *handler.SessionHandler,
+	mfaHandler *handler.MFAHandler,
+	webAuthnHandler *handler.WebAuthnHandler,
+	oauthHandler *handler.OAuthHandler,
+	keysHandler *handler.KeysHandler,
+) {
 
 	r.Use(cors.Default()) // тупо для работы сваггера, на проде так нельзя)
 
+	// Без локального Verifier каждый токен сверяется с сессией: отозванный токен сразу перестаёт работать
+	authenticator := authmw.New(nil, authmw.Options{Introspector: sessionIntrospector{verifier: tokenVerifier}})
+
 	auth := r.Group("/auth")
 	{
-		auth.POST("/tokens", authHandler.GenerateTokens)
+		auth.POST("/register", userHandler.Register)
+		auth.POST("/login", userHandler.Login)
+		auth.GET("/verify-email", userHandler.VerifyEmail)
+		auth.POST("/verify-email/resend", userHandler.ResendVerification)
+		auth.POST("/password/forgot", userHandler.ForgotPassword)
+		auth.POST("/password/reset", userHandler.ResetPassword)
+		auth.POST("/magic-link", userHandler.RequestMagicLink)
+		auth.POST("/magic-link/verify", userHandler.VerifyMagicLink)
 		auth.POST("/refresh", authHandler.RefreshTokens)
+		auth.POST("/revoke", authHandler.RevokeToken)
+		auth.POST("/logout", authHandler.RevokeToken)
+
+		auth.POST("/mfa/verify", mfaHandler.VerifyMFA)
+
+		mfa := auth.Group("/mfa", authenticator.RequireToken(), firstPartyOnly())
+		{
+			mfa.POST("/totp/enroll", mfaHandler.EnrollTOTP)
+			mfa.POST("/totp/confirm", mfaHandler.ConfirmTOTP)
+			mfa.POST("/totp/disable", mfaHandler.DisableTOTP)
+			mfa.POST("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		}
+
+		auth.POST("/webauthn/login/begin", webAuthnHandler.BeginLogin)
+		auth.POST("/webauthn/login/finish", webAuthnHandler.FinishLogin)
+
+		webAuthn := auth.Group("/webauthn", authenticator.RequireToken(), firstPartyOnly())
+		{
+			webAuthn.POST("/register/begin", webAuthnHandler.BeginRegistration)
+			webAuthn.POST("/register/finish", webAuthnHandler.FinishRegistration)
+			webAuthn.GET("/credentials", webAuthnHandler.ListCredentials)
+			webAuthn.DELETE("/credentials/:id", webAuthnHandler.DeleteCredential)
+		}
+
+		sessions := auth.Group("/sessions", authenticator.RequireToken(), authmw.RequireScopes("sessions"))
+		{
+			sessions.GET("", sessionHandler.ListSessions)
+			sessions.DELETE("", sessionHandler.RevokeAllSessions)
+			sessions.DELETE("/:id", sessionHandler.RevokeSession)
+		}
+
+		if cfg.Admin.APIKey != "" {
+			auth.POST("/tokens", adminAuth(cfg.Admin.APIKey), authHandler.GenerateTokens)
+		}
+
+		if len(cfg.Introspection.Clients) > 0 {
+			auth.POST("/introspect", gin.BasicAuthForRealm(cfg.Introspection.Clients, "introspection"), authHandler.IntrospectToken)
+		}
+	}
+	r.GET("/.well-known/jwks.json", keysHandler.JWKS)
+
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", oauthHandler.AuthorizePage)
+		oauth.POST("/authorize", authenticator.RequireToken(), firstPartyOnly(), oauthHandler.Authorize)
+		oauth.POST("/token", oauthHandler.Token)
+		oauth.GET("/clients/:client_id", oauthHandler.ClientInfo)
+	}
+
+	if cfg.Admin.APIKey != "" {
+		admin := r.Group("/admin", adminAuth(cfg.Admin.APIKey))
+		{
+			admin.GET("/keys", keysHandler.ListKeys)
+			admin.POST("/keys/:kid/promote", keysHandler.PromoteKey)
+			admin.POST("/oauth/clients", oauthHandler.RegisterClient)
+			admin.GET("/oauth/clients", oauthHandler.ListClients)
+			admin.DELETE("/oauth/clients/:client_id", oauthHandler.DeleteClient)
+		}
 	}
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 }
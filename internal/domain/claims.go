@@ -0,0 +1,42 @@
+package domain
+
+import "slices"
+
+// UserClaims - данные авторизации пользователя для access токена
+type UserClaims struct {
+	Roles         []string
+	AllowedScopes []string               // scopes, которые пользователь может запросить
+	Custom        map[string]interface{} // дополнительные claims
+}
+
+// GrantScopes проверяет запрошенные scopes по разрешённым.
+// Пустой запрос означает все разрешённые scopes
+func (c *UserClaims) GrantScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return slices.Clone(c.AllowedScopes), nil
+	}
+
+	granted := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !slices.Contains(c.AllowedScopes, scope) {
+			return nil, ErrScopeNotAllowed
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return granted, nil
+}
+
+// NarrowScopes оставляет из ранее выданных scopes только те, что разрешены сейчас.
+// Используется при обновлении токенов: права пользователя могли сократиться
+func (c *UserClaims) NarrowScopes(granted []string) []string {
+	narrowed := make([]string, 0, len(granted))
+	for _, scope := range granted {
+		if slices.Contains(c.AllowedScopes, scope) {
+			narrowed = append(narrowed, scope)
+		}
+	}
+	return narrowed
+}
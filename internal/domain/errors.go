@@ -0,0 +1,36 @@
+package domain
+
+import "errors"
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrTokenReused     = errors.New("refresh token reused")
+	ErrScopeNotAllowed = errors.New("scope not allowed")
+
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrEmailNotVerified   = errors.New("email not verified")
+
+	ErrInvalidOneTimeToken = errors.New("one-time token is invalid, expired or already used")
+	ErrTooManyRequests     = errors.New("too many requests")
+
+	ErrMFARequired       = errors.New("second factor required")
+	ErrMFAAlreadyEnabled = errors.New("second factor already enabled")
+	ErrMFANotEnabled     = errors.New("second factor not enabled")
+	ErrInvalidMFACode    = errors.New("invalid second factor code")
+	ErrInvalidMFAToken   = errors.New("mfa challenge token is invalid or expired")
+
+	ErrWebAuthnCeremonyInvalid    = errors.New("webauthn ceremony is invalid or expired")
+	ErrWebAuthnVerification       = errors.New("webauthn verification failed")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrReauthenticationRequired   = errors.New("recent authentication required")
+
+	ErrOAuthClientNotFound     = errors.New("oauth client not found")
+	ErrInvalidRedirectURI      = errors.New("redirect uri is not registered for the client")
+	ErrInvalidClient           = errors.New("oauth client authentication failed")
+	ErrInvalidGrant            = errors.New("authorization grant is invalid, expired or revoked")
+	ErrAuthorizationCodeReused = errors.New("authorization code reused")
+	ErrInvalidOAuthRequest     = errors.New("invalid oauth request")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+)
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserMFA - второй фактор пользователя (TOTP). До подтверждения первым кодом
+// секрет хранится, но не запрашивается при входе
+type UserMFA struct {
+	UserID         uuid.UUID
+	Secret         []byte // секрет TOTP, зашифрованный ключом сервиса
+	Enabled        bool
+	LastUsedStep   int64 // шаг последнего принятого кода, повторно он не принимается
+	FailedAttempts int
+	LastFailedAt   *time.Time
+	CreatedAt      time.Time
+	EnabledAt      *time.Time
+}
+
+// MFAChallenge возвращается вместо пары токенов, если у пользователя включён второй фактор.
+// Реализует error, errors.Is(err, ErrMFARequired) == true
+type MFAChallenge struct {
+	Token     string // токен MFA challenge для POST /auth/mfa/verify
+	ExpiresIn int64  // секунд до истечения токена
+}
+
+func (c *MFAChallenge) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (c *MFAChallenge) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// TOTPEnrollment - данные для добавления секрета в приложение-аутентификатор
+type TOTPEnrollment struct {
+	Secret    string // секрет в base32 для ручного ввода
+	URI       string // ссылка otpauth://
+	QRCodePNG []byte // QR код ссылки
+}
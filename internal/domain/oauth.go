@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CodeChallengeMethodS256 - единственный поддерживаемый метод PKCE (RFC 7636)
+const CodeChallengeMethodS256 = "S256"
+
+// OAuthClient - стороннее приложение, зарегистрированное как клиент OAuth 2.0
+type OAuthClient struct {
+	ID           string
+	SecretHash   string // пусто у публичных клиентов (SPA, мобильные приложения)
+	Name         string
+	RedirectURIs []string
+	Scopes       []string // scopes, которые клиент может запросить у пользователя
+	CreatedAt    time.Time
+}
+
+// Public сообщает, что клиент не хранит секрет и аутентифицируется только через PKCE
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// HasRedirectURI сверяет redirect_uri с зарегистрированными точным совпадением строк
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthorizationRequest - параметры запроса к /oauth/authorize
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationCode - выданный пользователем код авторизации. В БД хранится только хеш кода
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	AMR           []string // методы аутентификации пользователя, давшего согласие
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+// OAuthTokens - ответ /oauth/token (RFC 6749, раздел 5.1)
+type OAuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
+}
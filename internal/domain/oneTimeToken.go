@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Назначение одноразового токена: токен одного назначения не принимается в другом
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeMagicLink         = "magic_link"
+)
+
+// OneTimeToken - одноразовый токен из ссылки в письме. В БД хранится только хеш токена
+type OneTimeToken struct {
+	TokenHash  string
+	UserID     uuid.UUID
+	Purpose    string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	ConsumedAt *time.Time
+	NonceHash  string // хеш nonce из cookie устройства, запросившего вход по ссылке
+	CodeHash   string // хеш кода из письма, привязанный к nonce
+}
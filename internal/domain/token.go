@@ -6,10 +6,28 @@ import (
 )
 
 type RefreshSession struct {
-	ID        string // refresh_id
-	UserID    uuid.UUID
-	TokenHash string
-	UserIP    string
-	CreatedAt time.Time
-	ExpiresAt time.Time
+	ID         string // refresh_id
+	FamilyID   string // общий для всех сессий, полученных ротацией из одного входа
+	UserID     uuid.UUID
+	TokenHash  string
+	UserIP     string
+	UserAgent  string
+	Scopes     []string  // выданные при входе scopes, переносятся при обновлении токенов
+	AMR        []string  // методы аутентификации при входе, переносятся при обновлении токенов
+	ClientID   string    // OAuth клиент, которому выдана сессия, пусто для собственных приложений сервиса
+	CreatedAt  time.Time // время входа на устройстве, сохраняется при обновлении токенов
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	ConsumedAt *time.Time // не nil - сессия погашена ротацией и хранится как надгробие
+
+	// Пара токенов преемника, зашифрованная ключом из погашенного refresh токена.
+	// Возвращается повторному запросу того же клиента в течение grace периода
+	SuccessorTokens []byte
+}
+
+// ClientInfo описывает устройство, с которого пришёл запрос
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	ClientID  string // аутентифицированный OAuth клиент, пусто для собственных приложений сервиса
 }
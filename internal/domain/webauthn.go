@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Назначение церемонии WebAuthn
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential - ключ доступа (passkey) пользователя
+type WebAuthnCredential struct {
+	ID              []byte // credential ID, выданный аутентификатором
+	UserID          uuid.UUID
+	Name            string
+	PublicKey       []byte // открытый ключ в формате COSE
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte // модель аутентификатора
+	SignCount       uint32 // счётчик подписей, уменьшение - признак клонирования ключа
+	BackupEligible  bool
+	BackupState     bool // ключ синхронизирован между устройствами
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
+
+// WebAuthnCeremony - состояние начатой регистрации ключа или входа по ключу
+// между запросами begin и finish. Используется один раз
+type WebAuthnCeremony struct {
+	IDHash      string
+	UserID      *uuid.UUID // nil - вход по ключу, пользователь определяется ключом
+	Purpose     string
+	SessionData []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// WebAuthnOptions - параметры для navigator.credentials.create() или .get()
+// и ID церемонии, который нужно вернуть на шаге finish
+type WebAuthnOptions struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Options    json.RawMessage `json:"options" swaggertype:"object"`
+}
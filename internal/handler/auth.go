@@ -2,17 +2,22 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"github.com/medods/auth-service/internal/domain"
 	"github.com/medods/auth-service/pkg/jwt"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type AuthTokenUseCase interface {
-	GenerateTokens(ctx context.Context, userID uuid.UUID, userIP string) (*jwt.TokenPair, error)
-	RefreshTokens(ctx context.Context, refreshTokenBase64 string, userIP string) (*jwt.TokenPair, error)
+	GenerateTokens(ctx context.Context, userID uuid.UUID, scopes, amr []string, client domain.ClientInfo) (*jwt.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshTokenBase64 string, client domain.ClientInfo) (*jwt.TokenPair, error)
+	IntrospectToken(ctx context.Context, token string) (*domain.TokenIntrospection, error)
+	RevokeToken(ctx context.Context, token string) error
 }
 
 type AuthHandler struct {
@@ -30,14 +35,29 @@ type refreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// introspectRequest представляет запрос на интроспекцию токена (RFC 7662)
+type introspectRequest struct {
+	Token         string `form:"token" json:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+}
+
+// revokeRequest представляет запрос на отзыв токена (RFC 7009)
+type revokeRequest struct {
+	Token         string `form:"token" json:"token"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+}
+
 // @Summary Генерация токенов
-// @Description Генерирует пару access и refresh токенов для пользователя
+// @Description Генерирует пару access и refresh токенов для пользователя и открывает новую сессию (устройство). При превышении лимита сессий самая старая завершается. Служебный маршрут: требует административного ключа и отключён без ADMIN_API_KEY
 // @Tags auth
 // @Produce json
+// @Param X-Admin-Key header string true "Административный ключ"
 // @Param user_id query string true "ID пользователя в формате UUID"
+// @Param scope query string false "Запрашиваемые scopes через пробел (по умолчанию - все доступные пользователю)"
 // @Success 200 {object} jwt.TokenPair "Успешная генерация токенов"
-// @Failure 400 {object} map[string]string "Ошибка валидации (неправильный формат user_id или отсутствует параметр)"
-// @Failure 409 {object} map[string]string "Сессия уже существует (токены уже были сгенерированы для данного пользователя)"
+// @Failure 400 {object} map[string]string "Ошибка валидации (неправильный формат user_id, отсутствует параметр или недоступный scope)"
+// @Failure 401 {object} map[string]string "Неверный административный ключ"
+// @Failure 403 {object} mfaRequiredResponse "У пользователя включён второй фактор (mfa_required)"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /auth/tokens [post]
 func (h *AuthHandler) GenerateTokens(c *gin.Context) {
@@ -56,16 +76,18 @@ func (h *AuthHandler) GenerateTokens(c *gin.Context) {
 		return
 	}
 
-	userIP := c.ClientIP()
-
 	// Генерируем токены
-	tokens, err := h.tokenUseCase.GenerateTokens(c.Request.Context(), userID, userIP)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	scopes := strings.Fields(c.Query("scope"))
+	tokens, err := h.tokenUseCase.GenerateTokens(c.Request.Context(), userID, scopes, nil, clientInfo(c))
+	if mfaRequired(c, err) {
 		return
 	}
-	if tokens == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "сессия уже существует"})
+	if errors.Is(err, domain.ErrScopeNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "error_description": "запрошенный scope недоступен пользователю"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
 		return
 	}
 
@@ -92,10 +114,12 @@ func (h *AuthHandler) RefreshTokens(c *gin.Context) {
 		return
 	}
 
-	userIP := c.ClientIP()
-
 	// Обновляем токены
-	tokens, err := h.tokenUseCase.RefreshTokens(c.Request.Context(), req.RefreshToken, userIP)
+	tokens, err := h.tokenUseCase.RefreshTokens(c.Request.Context(), req.RefreshToken, clientInfo(c))
+	if errors.Is(err, jwt.ErrNotRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ожидается refresh токен, передан токен другого типа"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверный или истекший refresh токен"})
 		return
@@ -103,3 +127,84 @@ func (h *AuthHandler) RefreshTokens(c *gin.Context) {
 
 	c.JSON(http.StatusOK, tokens)
 }
+
+// @Summary Интроспекция токена
+// @Description Проверяет access или refresh токен с учётом отзыва сессии (RFC 7662). Требует Basic авторизации клиента
+// @Tags auth
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Security BasicAuth
+// @Param request body introspectRequest true "Токен"
+// @Success 200 {object} domain.TokenIntrospection "Результат интроспекции"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Клиент не аутентифицирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/introspect [post]
+func (h *AuthHandler) IntrospectToken(c *gin.Context) {
+	const op = "handler.auth.IntrospectToken"
+
+	var req introspectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		slog.Error(op, "невалидное тело запроса", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "невалидное тело запроса"})
+		return
+	}
+
+	result, err := h.tokenUseCase.IntrospectToken(c.Request.Context(), req.Token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	slog.Debug(op, "интроспекция токена",
+		slog.String("client_id", c.GetString(gin.AuthUserKey)),
+		slog.Bool("active", result.Active),
+	)
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Отзыв токена
+// @Description Завершает сессию, к которой относится access или refresh токен (RFC 7009). Токен передаётся в теле или в заголовке Authorization. Неизвестный или уже отозванный токен не считается ошибкой
+// @Tags auth
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Param request body revokeRequest false "Токен"
+// @Success 200 "Сессия завершена"
+// @Failure 400 {object} map[string]string "Токен не передан"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/revoke [post]
+// @Router /auth/logout [post]
+func (h *AuthHandler) RevokeToken(c *gin.Context) {
+	const op = "handler.auth.RevokeToken"
+
+	var req revokeRequest
+	if err := c.ShouldBind(&req); err != nil && c.Request.ContentLength > 0 {
+		slog.Error(op, "невалидное тело запроса", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "невалидное тело запроса"})
+		return
+	}
+
+	token := req.Token
+	if token == "" {
+		token, _ = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "токен обязателен"})
+		return
+	}
+
+	if err := h.tokenUseCase.RevokeToken(c.Request.Context(), token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// clientInfo собирает сведения об устройстве, с которого пришёл запрос
+func clientInfo(c *gin.Context) domain.ClientInfo {
+	return domain.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type KeySetProvider interface {
+	JWKS() jwt.JWKS
+	Keys() []jwt.KeyInfo
+	RotateKey(kid string) error
+}
+
+type KeysHandler struct {
+	keys KeySetProvider
+}
+
+func NewKeysHandler(keys KeySetProvider) *KeysHandler {
+	return &KeysHandler{
+		keys: keys,
+	}
+}
+
+// @Summary Публичные ключи подписи
+// @Description Возвращает JWKS с публичными ключами, которыми подписываются токены (пустой набор для HS512)
+// @Tags keys
+// @Produce json
+// @Success 200 {object} jwt.JWKS "Набор публичных ключей"
+// @Router /.well-known/jwks.json [get]
+func (h *KeysHandler) JWKS(c *gin.Context) {
+	// Ключи меняются редко, даём клиентам кешировать ответ
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
+// @Summary Состояние ключей подписи
+// @Description Возвращает ключи связки: активный и ключи только для проверки с датой вывода из работы
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Административный ключ"
+// @Success 200 {array} jwt.KeyInfo "Ключи подписи"
+// @Failure 401 {object} map[string]string "Неверный административный ключ"
+// @Router /admin/keys [get]
+func (h *KeysHandler) ListKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, h.keys.Keys())
+}
+
+// @Summary Ротация ключа подписи
+// @Description Делает ключ активным. Прежний ключ проверяет выпущенные им токены, пока не истечёт refresh TTL
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Административный ключ"
+// @Param kid path string true "kid ключа из JWT_VERIFY_KEYS"
+// @Success 200 {array} jwt.KeyInfo "Ключи подписи после ротации"
+// @Failure 401 {object} map[string]string "Неверный административный ключ"
+// @Failure 404 {object} map[string]string "Ключ не найден"
+// @Failure 409 {object} map[string]string "Ключ не содержит приватной части"
+// @Router /admin/keys/{kid}/promote [post]
+func (h *KeysHandler) PromoteKey(c *gin.Context) {
+	const op = "handler.keys.PromoteKey"
+
+	kid := c.Param("kid")
+
+	err := h.keys.RotateKey(kid)
+	switch {
+	case errors.Is(err, jwt.ErrKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "ключ не найден"})
+		return
+	case errors.Is(err, jwt.ErrKeyNotUsable):
+		c.JSON(http.StatusConflict, gin.H{"error": "ключ нельзя использовать для подписи"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	slog.Info(op, "ключ подписи сделан активным", slog.String("kid", kid))
+	c.JSON(http.StatusOK, h.keys.Keys())
+}
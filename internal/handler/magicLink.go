@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/medods/auth-service/internal/domain"
+)
+
+// magicLinkCookie хранит nonce устройства, запросившего вход по ссылке.
+// Cookie отправляется только на маршруты /auth/magic-link
+const (
+	magicLinkCookie     = "magic_link_nonce"
+	magicLinkCookiePath = "/auth/magic-link"
+)
+
+// magicLinkRequest представляет запрос письма для входа без пароля
+type magicLinkRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// magicLinkVerifyRequest - токен из ссылки или код из письма и необязательные scopes через пробел
+type magicLinkVerifyRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+	Scope string `json:"scope"`
+}
+
+// @Summary Вход по ссылке из письма
+// @Description Отправляет на email одноразовую ссылку и 6-значный код для входа без пароля и устанавливает cookie magic_link_nonce. Ссылка и код принимаются только вместе с этой cookie, то есть на устройстве, запросившем вход. Повторный запрос с того же устройства сохраняет cookie, и ссылки из прежних писем продолжают работать. Ответ не зависит от того, зарегистрирован ли адрес: письмо отправляется в фоне, а сверх ограничения частоты не отправляется молча
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body magicLinkRequest true "Email"
+// @Success 202 "Если адрес зарегистрирован, письмо будет отправлено"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/magic-link [post]
+func (h *UserHandler) RequestMagicLink(c *gin.Context) {
+	var req magicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email обязателен"})
+		return
+	}
+
+	nonce, _ := c.Cookie(magicLinkCookie)
+	nonce, expiresAt, err := h.userUseCase.RequestMagicLink(c.Request.Context(), req.Email, nonce)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	setMagicLinkCookie(c, nonce, int(time.Until(expiresAt).Seconds()))
+	c.Status(http.StatusAccepted)
+}
+
+// @Summary Завершение входа по письму
+// @Description Обменивает токен из ссылки или код из письма на пару токенов. Требует cookie magic_link_nonce, установленную при запросе письма. Код можно ввести ограниченное число раз. Вход подтверждает email, в amr токена - email
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body magicLinkVerifyRequest true "Токен из ссылки или код из письма и необязательные scopes"
+// @Success 200 {object} jwt.TokenPair "Успешный вход"
+// @Failure 400 {object} map[string]string "Ошибка валидации или недоступный scope"
+// @Failure 401 {object} map[string]string "Ссылка или код недействительны, истекли, уже использованы или запрошены с другого устройства"
+// @Failure 403 {object} mfaRequiredResponse "Требуется второй фактор (mfa_required)"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/magic-link/verify [post]
+func (h *UserHandler) VerifyMagicLink(c *gin.Context) {
+	var req magicLinkVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Token == "" && req.Code == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "требуется token или code"})
+		return
+	}
+
+	nonce, _ := c.Cookie(magicLinkCookie)
+	tokens, err := h.userUseCase.VerifyMagicLink(c.Request.Context(), nonce, req.Token, strings.TrimSpace(req.Code), strings.Fields(req.Scope), clientInfo(c))
+	if err == nil || errors.Is(err, domain.ErrMFARequired) {
+		// Ссылка погашена, nonce больше не нужен
+		setMagicLinkCookie(c, "", -1)
+	}
+	if mfaRequired(c, err) {
+		return
+	}
+	if errors.Is(err, domain.ErrInvalidOneTimeToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ссылка или код недействительны, истекли или запрошены с другого устройства"})
+		return
+	}
+	if errors.Is(err, domain.ErrScopeNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "error_description": "запрошенный scope недоступен пользователю"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// setMagicLinkCookie устанавливает или, при maxAge < 0, удаляет cookie с nonce устройства.
+// Secure не мешает локальной разработке: браузеры считают http://localhost безопасным
+func setMagicLinkCookie(c *gin.Context, nonce string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    nonce,
+		Path:     magicLinkCookiePath,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
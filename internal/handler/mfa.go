@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/authmw"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type MFAUseCase interface {
+	EnrollTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID uuid.UUID, code, recoveryCode string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	VerifyMFA(ctx context.Context, mfaToken, code, recoveryCode string, client domain.ClientInfo) (*jwt.TokenPair, error)
+}
+
+type MFAHandler struct {
+	mfaUseCase MFAUseCase
+}
+
+func NewMFAHandler(mfaUseCase MFAUseCase) *MFAHandler {
+	return &MFAHandler{
+		mfaUseCase: mfaUseCase,
+	}
+}
+
+// totpEnrollResponse - секрет TOTP для приложения-аутентификатора
+type totpEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"` // PNG в формате data URI
+}
+
+// totpCodeRequest представляет код из приложения-аутентификатора
+type totpCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// totpDisableRequest - код из приложения или код восстановления
+type totpDisableRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// recoveryCodesResponse - коды восстановления, показываются один раз
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaVerifyRequest представляет второй шаг входа
+type mfaVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// mfaRequiredResponse возвращается при входе пользователя с включённым вторым фактором
+type mfaRequiredResponse struct {
+	Error            string `json:"error" example:"mfa_required"`
+	ErrorDescription string `json:"error_description"`
+	MFAToken         string `json:"mfa_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+}
+
+// @Summary Настройка TOTP
+// @Description Создаёт секрет TOTP и возвращает его вместе со ссылкой otpauth:// и QR кодом. Второй фактор включается после подтверждения кодом из приложения. Повторный вызов до подтверждения заменяет секрет
+// @Tags mfa
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} totpEnrollResponse "Секрет для приложения-аутентификатора"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 409 {object} map[string]string "Второй фактор уже включён"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/totp/enroll [post]
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	enrollment, err := h.mfaUseCase.EnrollTOTP(c.Request.Context(), claims.UserID)
+	if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "второй фактор уже включён"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, totpEnrollResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCodePNG),
+	})
+}
+
+// @Summary Подтверждение TOTP
+// @Description Включает второй фактор по коду из приложения-аутентификатора и возвращает коды восстановления. Коды показываются один раз
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body totpCodeRequest true "Код из приложения"
+// @Success 200 {object} recoveryCodesResponse "Второй фактор включён"
+// @Failure 400 {object} map[string]string "Неверный код или настройка не начата"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 409 {object} map[string]string "Второй фактор уже включён"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code обязателен"})
+		return
+	}
+
+	codes, err := h.mfaUseCase.ConfirmTOTP(c.Request.Context(), claims.UserID, req.Code)
+	if errors.Is(err, domain.ErrMFANotEnabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "настройка второго фактора не начата"})
+		return
+	}
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Отключение TOTP
+// @Description Отключает второй фактор. Требуется код из приложения или код восстановления
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body totpDisableRequest true "Код из приложения или код восстановления"
+// @Success 204 "Второй фактор отключён"
+// @Failure 400 {object} map[string]string "Неверный код"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 409 {object} map[string]string "Второй фактор не включён"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/totp/disable [post]
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	var req totpDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "требуется code или recovery_code"})
+		return
+	}
+
+	if err := h.mfaUseCase.DisableTOTP(c.Request.Context(), claims.UserID, req.Code, req.RecoveryCode); err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Новые коды восстановления
+// @Description Заменяет коды восстановления новыми, прежние перестают действовать. Требуется код из приложения
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body totpCodeRequest true "Код из приложения"
+// @Success 200 {object} recoveryCodesResponse "Новые коды восстановления"
+// @Failure 400 {object} map[string]string "Неверный код"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 409 {object} map[string]string "Второй фактор не включён"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code обязателен"})
+		return
+	}
+
+	codes, err := h.mfaUseCase.RegenerateRecoveryCodes(c.Request.Context(), claims.UserID, req.Code)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Проверка второго фактора
+// @Description Завершает вход пользователя с включённым вторым фактором: принимает mfa_token из ответа mfa_required и код из приложения или код восстановления. Открывает сессию с запрошенными при входе scopes, в amr токена добавляются otp и mfa. mfa_token одноразовый: после успешной проверки повторно не принимается
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body mfaVerifyRequest true "Токен MFA challenge и код"
+// @Success 200 {object} jwt.TokenPair "Успешный вход"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Неверный код, недействительный или уже использованный mfa_token"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/mfa/verify [post]
+func (h *MFAHandler) VerifyMFA(c *gin.Context) {
+	var req mfaVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "требуются mfa_token и code или recovery_code"})
+		return
+	}
+
+	tokens, err := h.mfaUseCase.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code, req.RecoveryCode, clientInfo(c))
+	switch {
+	case errors.Is(err, domain.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "mfa_token недействителен, истёк или уже использован, войдите заново"})
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверный код"})
+	case errors.Is(err, domain.ErrTooManyRequests):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "слишком много неверных кодов, попробуйте позже"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	default:
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// mfaError отвечает на ошибку управления вторым фактором
+func mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный код"})
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "второй фактор уже включён"})
+	case errors.Is(err, domain.ErrMFANotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "второй фактор не включён"})
+	case errors.Is(err, domain.ErrTooManyRequests):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "слишком много неверных кодов, попробуйте позже"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	}
+}
+
+// mfaRequired отвечает mfa_required, если вместо пары токенов получен *domain.MFAChallenge
+func mfaRequired(c *gin.Context, err error) bool {
+	var challenge *domain.MFAChallenge
+	if !errors.As(err, &challenge) {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, mfaRequiredResponse{
+		Error:            "mfa_required",
+		ErrorDescription: "требуется второй фактор: отправьте mfa_token и код на /auth/mfa/verify",
+		MFAToken:         challenge.Token,
+		ExpiresIn:        challenge.ExpiresIn,
+	})
+	return true
+}
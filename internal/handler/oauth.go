@@ -0,0 +1,457 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/authmw"
+)
+
+type OAuthUseCase interface {
+	RegisterClient(ctx context.Context, name string, redirectURIs, scopes []string, public bool) (*domain.OAuthClient, string, error)
+	GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error)
+	ListClients(ctx context.Context) ([]domain.OAuthClient, error)
+	DeleteClient(ctx context.Context, clientID string) error
+	ValidateAuthorization(ctx context.Context, req *domain.AuthorizationRequest) (*domain.OAuthClient, error)
+	Authorize(ctx context.Context, userID uuid.UUID, amr []string, req *domain.AuthorizationRequest) (string, error)
+	ExchangeCode(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string, client domain.ClientInfo) (*domain.OAuthTokens, error)
+	RefreshTokens(ctx context.Context, clientID, clientSecret, refreshToken string, client domain.ClientInfo) (*domain.OAuthTokens, error)
+}
+
+type OAuthHandler struct {
+	oauthUseCase OAuthUseCase
+	consentURL   string
+}
+
+func NewOAuthHandler(oauthUseCase OAuthUseCase, consentURL string) *OAuthHandler {
+	return &OAuthHandler{
+		oauthUseCase: oauthUseCase,
+		consentURL:   consentURL,
+	}
+}
+
+// authorizeParams - параметры запроса авторизации (RFC 6749, раздел 4.1.1; RFC 7636, раздел 4.3)
+type authorizeParams struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// oauthConsentRequest - решение пользователя на странице согласия и исходные параметры запроса
+type oauthConsentRequest struct {
+	authorizeParams
+	Approve bool `json:"approve"`
+}
+
+// oauthRedirectResponse - адрес, на который страница согласия перенаправляет браузер
+type oauthRedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// oauthTokenRequest - параметры /oauth/token в application/x-www-form-urlencoded
+type oauthTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// oauthClientRequest - регистрация клиента. Публичный клиент (SPA, мобильное приложение) не получает секрет
+type oauthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,required"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,required"`
+	Public       bool     `json:"public"`
+}
+
+// oauthClientResponse описывает зарегистрированного клиента
+type oauthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"` // только в ответе на регистрацию
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// oauthClientInfoResponse - публичные сведения о клиенте для страницы согласия
+type oauthClientInfoResponse struct {
+	ClientID string `json:"client_id"`
+	Name     string `json:"name"`
+}
+
+// @Summary Запрос авторизации OAuth 2.0
+// @Description Проверяет клиента, redirect_uri, scope и PKCE (только S256) и перенаправляет браузер на страницу согласия OAUTH_CONSENT_URL с теми же параметрами. Ошибки клиента и redirect_uri возвращаются пользователю, остальные - клиенту на redirect_uri
+// @Tags oauth
+// @Produce json
+// @Param response_type query string true "Только code"
+// @Param client_id query string true "ID клиента"
+// @Param redirect_uri query string false "Зарегистрированный redirect_uri, необязателен при единственном"
+// @Param scope query string false "Scopes через пробел, по умолчанию все scopes клиента"
+// @Param state query string false "Значение, которое вернётся клиенту"
+// @Param code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param code_challenge_method query string true "Только S256"
+// @Success 302 "Перенаправление на страницу согласия или на redirect_uri с ошибкой"
+// @Failure 400 {object} map[string]string "Клиент не зарегистрирован или неверный redirect_uri"
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) AuthorizePage(c *gin.Context) {
+	var params authorizeParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "неверные параметры запроса"})
+		return
+	}
+
+	req := params.toDomain()
+	_, err := h.oauthUseCase.ValidateAuthorization(c.Request.Context(), &req)
+	if h.abortAuthorization(c, err) {
+		return
+	}
+	if err != nil {
+		c.Redirect(http.StatusFound, authorizationErrorRedirect(&req, err))
+		return
+	}
+
+	c.Redirect(http.StatusFound, appendQuery(h.consentURL, c.Request.URL.Query()))
+}
+
+// @Summary Согласие пользователя OAuth 2.0
+// @Description Страница согласия передаёт решение пользователя и исходные параметры запроса. При согласии выдаётся одноразовый код авторизации, в ответе - адрес redirect_uri с code и state (или с error=access_denied при отказе). Принимается только access токен собственного приложения сервиса; если у пользователя включён второй фактор, токен должен быть выдан после его прохождения
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body oauthConsentRequest true "Параметры запроса авторизации и решение пользователя"
+// @Success 200 {object} oauthRedirectResponse "Адрес для перенаправления браузера"
+// @Failure 400 {object} map[string]string "Клиент не зарегистрирован или неверный redirect_uri"
+// @Failure 401 {object} map[string]string "Неверный access токен или требуется второй фактор"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /oauth/authorize [post]
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	// Токен стороннего клиента сюда не доходит: маршрут закрыт для него middleware
+	claims, _ := authmw.Claims(c)
+
+	var body oauthConsentRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "неверные параметры запроса"})
+		return
+	}
+
+	req := body.toDomain()
+	if !body.Approve {
+		_, err := h.oauthUseCase.ValidateAuthorization(c.Request.Context(), &req)
+		if h.abortAuthorization(c, err) {
+			return
+		}
+		if err == nil {
+			err = errAccessDenied
+		}
+		c.JSON(http.StatusOK, oauthRedirectResponse{RedirectTo: authorizationErrorRedirect(&req, err)})
+		return
+	}
+
+	code, err := h.oauthUseCase.Authorize(c.Request.Context(), claims.UserID, claims.AMR, &req)
+	if h.abortAuthorization(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, domain.ErrMFARequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "insufficient_user_authentication", "error_description": "подтвердите вход вторым фактором"})
+	case errors.Is(err, domain.ErrUnsupportedResponseType), errors.Is(err, domain.ErrInvalidOAuthRequest), errors.Is(err, domain.ErrScopeNotAllowed):
+		c.JSON(http.StatusOK, oauthRedirectResponse{RedirectTo: authorizationErrorRedirect(&req, err)})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	default:
+		params := url.Values{"code": {code}}
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+		c.JSON(http.StatusOK, oauthRedirectResponse{RedirectTo: appendQuery(req.RedirectURI, params)})
+	}
+}
+
+// @Summary Выпуск токенов OAuth 2.0
+// @Description Обменивает код авторизации (grant_type=authorization_code, обязателен code_verifier) или refresh токен клиента (grant_type=refresh_token) на пару токенов. Конфиденциальный клиент аутентифицируется через HTTP Basic или client_secret в теле, публичный передаёт только client_id. Refresh токен принимается только от клиента, которому выдан
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code или refresh_token"
+// @Param code formData string false "Код авторизации"
+// @Param redirect_uri formData string false "redirect_uri из запроса авторизации"
+// @Param code_verifier formData string false "PKCE code_verifier"
+// @Param refresh_token formData string false "Refresh токен"
+// @Param client_id formData string false "ID клиента, если не передан через HTTP Basic"
+// @Param client_secret formData string false "Секрет конфиденциального клиента, если не передан через HTTP Basic"
+// @Success 200 {object} domain.OAuthTokens "Пара токенов"
+// @Failure 400 {object} map[string]string "invalid_request, invalid_grant или unsupported_grant_type"
+// @Failure 401 {object} map[string]string "invalid_client"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req oauthTokenRequest
+	if err := c.ShouldBindWith(&req, binding.FormPost); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "ожидается application/x-www-form-urlencoded"})
+		return
+	}
+
+	clientID, clientSecret := req.ClientID, req.ClientSecret
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		// Клиент использует только один способ аутентификации (RFC 6749, раздел 2.3)
+		if clientSecret != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "секрет клиента передан дважды"})
+			return
+		}
+		// В HTTP Basic client_id и секрет закодированы как application/x-www-form-urlencoded (RFC 6749, раздел 2.3.1)
+		var err error
+		if clientID, err = url.QueryUnescape(username); err == nil {
+			clientSecret, err = url.QueryUnescape(password)
+		}
+		if err != nil || (req.ClientID != "" && req.ClientID != clientID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "неверные данные клиента"})
+			return
+		}
+	}
+
+	var tokens *domain.OAuthTokens
+	var err error
+	switch req.GrantType {
+	case "authorization_code":
+		if req.Code == "" || req.CodeVerifier == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "code и code_verifier обязательны"})
+			return
+		}
+		tokens, err = h.oauthUseCase.ExchangeCode(c.Request.Context(), clientID, clientSecret, req.Code, req.RedirectURI, req.CodeVerifier, clientInfo(c))
+	case "refresh_token":
+		if req.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "refresh_token обязателен"})
+			return
+		}
+		tokens, err = h.oauthUseCase.RefreshTokens(c.Request.Context(), clientID, clientSecret, req.RefreshToken, clientInfo(c))
+	case "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "grant_type обязателен"})
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		return
+	}
+
+	switch {
+	case errors.Is(err, domain.ErrInvalidClient):
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client", "error_description": "клиент не прошёл аутентификацию"})
+	case errors.Is(err, domain.ErrInvalidGrant):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "код или refresh токен недействителен"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+	default:
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// @Summary Сведения о клиенте OAuth 2.0
+// @Description Возвращает название клиента для страницы согласия
+// @Tags oauth
+// @Produce json
+// @Param client_id path string true "ID клиента"
+// @Success 200 {object} oauthClientInfoResponse "Клиент"
+// @Failure 404 {object} map[string]string "Клиент не зарегистрирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /oauth/clients/{client_id} [get]
+func (h *OAuthHandler) ClientInfo(c *gin.Context) {
+	client, err := h.oauthUseCase.GetClient(c.Request.Context(), c.Param("client_id"))
+	if errors.Is(err, domain.ErrOAuthClientNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "клиент не зарегистрирован"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, oauthClientInfoResponse{ClientID: client.ID, Name: client.Name})
+}
+
+// @Summary Регистрация клиента OAuth 2.0
+// @Description Регистрирует стороннее приложение. redirect_uri - https, http только для localhost и loopback адресов или собственная схема вида com.example.app. Секрет конфиденциального клиента возвращается один раз
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Административный ключ"
+// @Param request body oauthClientRequest true "Название, redirect_uris, scopes и тип клиента"
+// @Success 201 {object} oauthClientResponse "Клиент зарегистрирован"
+// @Failure 400 {object} map[string]string "Ошибка валидации или недопустимый redirect_uri"
+// @Failure 401 {object} map[string]string "Неверный административный ключ"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/oauth/clients [post]
+func (h *OAuthHandler) RegisterClient(c *gin.Context) {
+	var req oauthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name, redirect_uris и scopes обязательны"})
+		return
+	}
+	// scopes хранятся и выдаются строкой через пробел
+	for _, scope := range req.Scopes {
+		if strings.ContainsAny(scope, " \t\r\n") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scope не может содержать пробелы"})
+			return
+		}
+	}
+
+	client, secret, err := h.oauthUseCase.RegisterClient(c.Request.Context(), req.Name, req.RedirectURIs, req.Scopes, req.Public)
+	if errors.Is(err, domain.ErrInvalidRedirectURI) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "недопустимый redirect_uri"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	resp := newOAuthClientResponse(client)
+	resp.ClientSecret = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary Список клиентов OAuth 2.0
+// @Description Возвращает зарегистрированных клиентов без секретов
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Административный ключ"
+// @Success 200 {array} oauthClientResponse "Клиенты"
+// @Failure 401 {object} map[string]string "Неверный административный ключ"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/oauth/clients [get]
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	clients, err := h.oauthUseCase.ListClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	resp := make([]oauthClientResponse, 0, len(clients))
+	for i := range clients {
+		resp = append(resp, newOAuthClientResponse(&clients[i]))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Удаление клиента OAuth 2.0
+// @Description Удаляет клиента, его неиспользованные коды авторизации и все выданные ему сессии
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Административный ключ"
+// @Param client_id path string true "ID клиента"
+// @Success 204 "Клиент удалён"
+// @Failure 401 {object} map[string]string "Неверный административный ключ"
+// @Failure 404 {object} map[string]string "Клиент не зарегистрирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /admin/oauth/clients/{client_id} [delete]
+func (h *OAuthHandler) DeleteClient(c *gin.Context) {
+	err := h.oauthUseCase.DeleteClient(c.Request.Context(), c.Param("client_id"))
+	if errors.Is(err, domain.ErrOAuthClientNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "клиент не зарегистрирован"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// errAccessDenied - пользователь отказал клиенту в доступе
+var errAccessDenied = errors.New("access denied")
+
+// abortAuthorization отвечает пользователю на ошибки клиента и redirect_uri: перенаправлять
+// на непроверенный redirect_uri нельзя (RFC 6749, раздел 4.1.2.1)
+func (h *OAuthHandler) abortAuthorization(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, domain.ErrOAuthClientNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "клиент не зарегистрирован"})
+	case errors.Is(err, domain.ErrInvalidRedirectURI):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "redirect_uri не зарегистрирован у клиента"})
+	default:
+		return false
+	}
+	return true
+}
+
+// authorizationErrorRedirect возвращает redirect_uri с кодом ошибки для клиента
+func authorizationErrorRedirect(req *domain.AuthorizationRequest, err error) string {
+	code := "server_error"
+	switch {
+	case errors.Is(err, errAccessDenied):
+		code = "access_denied"
+	case errors.Is(err, domain.ErrUnsupportedResponseType):
+		code = "unsupported_response_type"
+	case errors.Is(err, domain.ErrInvalidOAuthRequest):
+		code = "invalid_request"
+	case errors.Is(err, domain.ErrScopeNotAllowed):
+		code = "invalid_scope"
+	}
+
+	params := url.Values{"error": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params)
+}
+
+// appendQuery добавляет параметры к адресу, сохраняя его собственные параметры
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (p *authorizeParams) toDomain() domain.AuthorizationRequest {
+	return domain.AuthorizationRequest{
+		ResponseType:        p.ResponseType,
+		ClientID:            p.ClientID,
+		RedirectURI:         p.RedirectURI,
+		Scopes:              strings.Fields(p.Scope),
+		State:               p.State,
+		CodeChallenge:       p.CodeChallenge,
+		CodeChallengeMethod: p.CodeChallengeMethod,
+	}
+}
+
+func newOAuthClientResponse(client *domain.OAuthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		Public:       client.Public(),
+		CreatedAt:    client.CreatedAt,
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/authmw"
+)
+
+type SessionUseCase interface {
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]domain.RefreshSession, error)
+	RevokeSession(ctx context.Context, userID uuid.UUID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+type SessionHandler struct {
+	sessionUseCase SessionUseCase
+}
+
+func NewSessionHandler(sessionUseCase SessionUseCase) *SessionHandler {
+	return &SessionHandler{
+		sessionUseCase: sessionUseCase,
+	}
+}
+
+// sessionResponse описывает сессию (устройство) пользователя
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	ClientID   string    `json:"client_id,omitempty"` // OAuth клиент, которому выдана сессия
+	Current    bool      `json:"current"`             // сессия, к которой относится access токен запроса
+}
+
+// @Summary Список сессий
+// @Description Возвращает действующие сессии (устройства) текущего пользователя
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} sessionResponse "Сессии пользователя"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токену не выдан scope sessions"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	sessions, err := h.sessionUseCase.ListSessions(c.Request.Context(), claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, sessionResponse{
+			ID:         session.ID,
+			IP:         session.UserIP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			ClientID:   session.ClientID,
+			Current:    session.ID == claims.RefreshID,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Завершение сессии
+// @Description Завершает одну сессию (устройство) текущего пользователя
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID сессии"
+// @Success 204 "Сессия завершена"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токену не выдан scope sessions"
+// @Failure 404 {object} map[string]string "Сессия не найдена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	err := h.sessionUseCase.RevokeSession(c.Request.Context(), claims.UserID, c.Param("id"))
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "сессия не найдена"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Выход со всех устройств
+// @Description Завершает все сессии текущего пользователя, включая текущую
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 204 "Сессии завершены"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токену не выдан scope sessions"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/sessions [delete]
+func (h *SessionHandler) RevokeAllSessions(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	if err := h.sessionUseCase.RevokeAllSessions(c.Request.Context(), claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
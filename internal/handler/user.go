@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type UserUseCase interface {
+	Register(ctx context.Context, email, password string) error
+	Login(ctx context.Context, email, password string, scopes []string, client domain.ClientInfo) (*jwt.TokenPair, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string)
+	ForgotPassword(ctx context.Context, email string)
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	RequestMagicLink(ctx context.Context, email, nonce string) (string, time.Time, error)
+	VerifyMagicLink(ctx context.Context, nonce, token, code string, scopes []string, client domain.ClientInfo) (*jwt.TokenPair, error)
+}
+
+type UserHandler struct {
+	userUseCase UserUseCase
+}
+
+func NewUserHandler(userUseCase UserUseCase) *UserHandler {
+	return &UserHandler{
+		userUseCase: userUseCase,
+	}
+}
+
+// registerRequest представляет запрос на регистрацию
+type registerRequest struct {
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+// loginRequest представляет запрос на вход
+type loginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Scope    string `json:"scope"`
+}
+
+// @Summary Регистрация
+// @Description Создаёт пользователя с email и паролем и отправляет письмо подтверждения email. Пароль хранится в виде хеша Argon2id. Ответ не зависит от того, занят ли email: владельцу существующего аккаунта вместо этого уходит письмо о попытке регистрации со ссылкой сброса пароля. Сессию открывает вход
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body registerRequest true "Email и пароль (от 8 до 128 символов)"
+// @Success 202 "Заявка принята, дальнейшие шаги - в письме"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/register [post]
+func (h *UserHandler) Register(c *gin.Context) {
+	const op = "handler.user.Register"
+
+	var req registerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Debug(op, "невалидное тело запроса", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "невалидный email или пароль короче 8 символов"})
+		return
+	}
+
+	if err := h.userUseCase.Register(c.Request.Context(), req.Email, req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// @Summary Вход
+// @Description Проверяет email и пароль и открывает новую сессию (устройство)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body loginRequest true "Email, пароль и необязательные scopes через пробел"
+// @Success 200 {object} jwt.TokenPair "Успешный вход"
+// @Failure 400 {object} map[string]string "Ошибка валидации или недоступный scope"
+// @Failure 401 {object} map[string]string "Неверный email или пароль"
+// @Failure 403 {object} mfaRequiredResponse "Email не подтверждён или требуется второй фактор (mfa_required)"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/login [post]
+func (h *UserHandler) Login(c *gin.Context) {
+	const op = "handler.user.Login"
+
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Debug(op, "невалидное тело запроса", slog.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email и пароль обязательны"})
+		return
+	}
+
+	tokens, err := h.userUseCase.Login(c.Request.Context(), req.Email, req.Password, strings.Fields(req.Scope), clientInfo(c))
+	if mfaRequired(c, err) {
+		return
+	}
+	if errors.Is(err, domain.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "неверный email или пароль"})
+		return
+	}
+	if errors.Is(err, domain.ErrEmailNotVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email не подтверждён"})
+		return
+	}
+	if errors.Is(err, domain.ErrScopeNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "error_description": "запрошенный scope недоступен пользователю"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// resendVerificationRequest представляет запрос на повторную отправку письма подтверждения
+type resendVerificationRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// @Summary Подтверждение email
+// @Description Подтверждает email по одноразовой ссылке из письма. После подтверждения войдите заново, чтобы получить полный набор scopes
+// @Tags users
+// @Produce json
+// @Param token query string true "Токен из ссылки"
+// @Success 200 {object} map[string]string "Email подтверждён"
+// @Failure 400 {object} map[string]string "Ссылка недействительна, истекла или уже использована"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/verify-email [get]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token обязателен"})
+		return
+	}
+
+	err := h.userUseCase.VerifyEmail(c.Request.Context(), token)
+	if errors.Is(err, domain.ErrInvalidOneTimeToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ссылка недействительна, истекла или уже использована"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "email подтверждён"})
+}
+
+// @Summary Повторное письмо подтверждения
+// @Description Отправляет новую ссылку подтверждения email. Ответ не зависит от того, зарегистрирован ли адрес: письмо отправляется в фоне, а сверх ограничения частоты не отправляется молча
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body resendVerificationRequest true "Email"
+// @Success 202 "Если адрес зарегистрирован и не подтверждён, письмо будет отправлено"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Router /auth/verify-email/resend [post]
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	var req resendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email обязателен"})
+		return
+	}
+
+	h.userUseCase.ResendVerification(c.Request.Context(), req.Email)
+	c.Status(http.StatusAccepted)
+}
+
+// forgotPasswordRequest представляет запрос ссылки сброса пароля
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// resetPasswordRequest представляет запрос на установку нового пароля
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+// @Summary Забыли пароль
+// @Description Отправляет на email одноразовую ссылку сброса пароля. Ответ не зависит от того, зарегистрирован ли адрес: письмо отправляется в фоне
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body forgotPasswordRequest true "Email"
+// @Success 202 "Если адрес зарегистрирован, письмо будет отправлено"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Router /auth/password/forgot [post]
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email обязателен"})
+		return
+	}
+
+	h.userUseCase.ForgotPassword(c.Request.Context(), req.Email)
+	c.Status(http.StatusAccepted)
+}
+
+// @Summary Сброс пароля
+// @Description Устанавливает новый пароль по токену из письма и завершает все сессии пользователя
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body resetPasswordRequest true "Токен из письма и новый пароль (от 8 до 128 символов)"
+// @Success 204 "Пароль изменён"
+// @Failure 400 {object} map[string]string "Ошибка валидации или недействительная ссылка"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/password/reset [post]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "токен обязателен, пароль должен быть от 8 до 128 символов"})
+		return
+	}
+
+	err := h.userUseCase.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	if errors.Is(err, domain.ErrInvalidOneTimeToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ссылка недействительна, истекла или уже использована"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
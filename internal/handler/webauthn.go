@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/authmw"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type WebAuthnUseCase interface {
+	BeginRegistration(ctx context.Context, claims *jwt.TokenClaims) (*domain.WebAuthnOptions, error)
+	FinishRegistration(ctx context.Context, userID uuid.UUID, ceremonyID, name string, response []byte) (*domain.WebAuthnCredential, error)
+	BeginLogin(ctx context.Context) (*domain.WebAuthnOptions, error)
+	FinishLogin(ctx context.Context, ceremonyID string, response []byte, scopes []string, client domain.ClientInfo) (*jwt.TokenPair, error)
+	ListCredentials(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error)
+	DeleteCredential(ctx context.Context, userID uuid.UUID, credentialID []byte) error
+}
+
+type WebAuthnHandler struct {
+	webAuthnUseCase WebAuthnUseCase
+}
+
+func NewWebAuthnHandler(webAuthnUseCase WebAuthnUseCase) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webAuthnUseCase: webAuthnUseCase,
+	}
+}
+
+// webAuthnRegisterRequest - ответ navigator.credentials.create()
+type webAuthnRegisterRequest struct {
+	CeremonyID string          `json:"ceremony_id" binding:"required"`
+	Name       string          `json:"name" binding:"max=255"`
+	Credential json.RawMessage `json:"credential" binding:"required" swaggertype:"object"`
+}
+
+// webAuthnLoginRequest - ответ navigator.credentials.get() и необязательные scopes через пробел
+type webAuthnLoginRequest struct {
+	CeremonyID string          `json:"ceremony_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required" swaggertype:"object"`
+	Scope      string          `json:"scope"`
+}
+
+// webAuthnCredentialResponse описывает ключ доступа пользователя
+type webAuthnCredentialResponse struct {
+	ID          string     `json:"id"` // credential ID в base64url
+	Name        string     `json:"name"`
+	Synced      bool       `json:"synced"` // ключ синхронизирован между устройствами
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	Transports  []string   `json:"transports,omitempty"`
+	Attestation string     `json:"attestation,omitempty"`
+}
+
+// @Summary Начало регистрации ключа доступа
+// @Description Возвращает параметры для navigator.credentials.create() и ID церемонии. Регистрируются платформенные аутентификаторы с проверкой пользователя. Нужен access токен недавнего входа (auth_time не старше WEBAUTHN_REAUTH_MAX_AGE), а при включённом втором факторе - с mfa в amr
+// @Tags webauthn
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} domain.WebAuthnOptions "Параметры регистрации"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен либо нужен повторный вход (insufficient_user_authentication)"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/webauthn/register/begin [post]
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	options, err := h.webAuthnUseCase.BeginRegistration(c.Request.Context(), claims)
+	if errors.Is(err, domain.ErrReauthenticationRequired) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication"`)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":             "insufficient_user_authentication",
+			"error_description": "для регистрации ключа доступа войдите заново, с вторым фактором, если он включён",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// @Summary Завершение регистрации ключа доступа
+// @Description Проверяет ответ аутентификатора и сохраняет ключ доступа
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body webAuthnRegisterRequest true "ID церемонии, название ключа и ответ navigator.credentials.create()"
+// @Success 201 {object} webAuthnCredentialResponse "Ключ доступа зарегистрирован"
+// @Failure 400 {object} map[string]string "Церемония недействительна или ответ аутентификатора не прошёл проверку"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 409 {object} map[string]string "Ключ уже зарегистрирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/webauthn/register/finish [post]
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	var req webAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ceremony_id и credential обязательны"})
+		return
+	}
+
+	credential, err := h.webAuthnUseCase.FinishRegistration(c.Request.Context(), claims.UserID, req.CeremonyID, req.Name, req.Credential)
+	switch {
+	case errors.Is(err, domain.ErrWebAuthnCeremonyInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "церемония недействительна или истекла, начните регистрацию заново"})
+	case errors.Is(err, domain.ErrWebAuthnVerification):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ответ аутентификатора не прошёл проверку"})
+	case errors.Is(err, domain.ErrWebAuthnCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "ключ доступа уже зарегистрирован"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	default:
+		c.JSON(http.StatusCreated, newWebAuthnCredentialResponse(credential))
+	}
+}
+
+// @Summary Начало входа по ключу доступа
+// @Description Возвращает параметры для navigator.credentials.get() и ID церемонии. Email не нужен: пользователя определяет выбранный ключ
+// @Tags webauthn
+// @Produce json
+// @Success 200 {object} domain.WebAuthnOptions "Параметры входа"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/webauthn/login/begin [post]
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	options, err := h.webAuthnUseCase.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// @Summary Вход по ключу доступа
+// @Description Проверяет подпись аутентификатора и открывает новую сессию. Ключ доступа с проверкой пользователя считается двумя факторами: amr токена - hwk и mfa
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body webAuthnLoginRequest true "ID церемонии, ответ navigator.credentials.get() и необязательные scopes"
+// @Success 200 {object} jwt.TokenPair "Успешный вход"
+// @Failure 400 {object} map[string]string "Ошибка валидации или недоступный scope"
+// @Failure 401 {object} map[string]string "Церемония недействительна или подпись не прошла проверку"
+// @Failure 403 {object} map[string]string "Email не подтверждён"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/webauthn/login/finish [post]
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req webAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ceremony_id и credential обязательны"})
+		return
+	}
+
+	tokens, err := h.webAuthnUseCase.FinishLogin(c.Request.Context(), req.CeremonyID, req.Credential, strings.Fields(req.Scope), clientInfo(c))
+	switch {
+	case errors.Is(err, domain.ErrWebAuthnCeremonyInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "церемония недействительна или истекла, начните вход заново"})
+	case errors.Is(err, domain.ErrWebAuthnVerification):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ключ доступа не прошёл проверку"})
+	case errors.Is(err, domain.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": "email не подтверждён"})
+	case errors.Is(err, domain.ErrScopeNotAllowed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "error_description": "запрошенный scope недоступен пользователю"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	default:
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// @Summary Список ключей доступа
+// @Description Возвращает ключи доступа (passkeys) текущего пользователя
+// @Tags webauthn
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} webAuthnCredentialResponse "Ключи доступа"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/webauthn/credentials [get]
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	credentials, err := h.webAuthnUseCase.ListCredentials(c.Request.Context(), claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	resp := make([]webAuthnCredentialResponse, 0, len(credentials))
+	for i := range credentials {
+		resp = append(resp, newWebAuthnCredentialResponse(&credentials[i]))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Удаление ключа доступа
+// @Description Удаляет ключ доступа текущего пользователя
+// @Tags webauthn
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID ключа в base64url"
+// @Success 204 "Ключ удалён"
+// @Failure 401 {object} map[string]string "Неверный или истекший access токен"
+// @Failure 403 {object} map[string]string "Токен выдан OAuth клиенту"
+// @Failure 404 {object} map[string]string "Ключ не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /auth/webauthn/credentials/{id} [delete]
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	claims, _ := authmw.Claims(c)
+
+	credentialID, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ключ доступа не найден"})
+		return
+	}
+
+	err = h.webAuthnUseCase.DeleteCredential(c.Request.Context(), claims.UserID, credentialID)
+	if errors.Is(err, domain.ErrWebAuthnCredentialNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ключ доступа не найден"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func newWebAuthnCredentialResponse(credential *domain.WebAuthnCredential) webAuthnCredentialResponse {
+	return webAuthnCredentialResponse{
+		ID:          base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:        credential.Name,
+		Synced:      credential.BackupState,
+		CreatedAt:   credential.CreatedAt,
+		LastUsedAt:  credential.LastUsedAt,
+		Transports:  credential.Transports,
+		Attestation: credential.AttestationType,
+	}
+}
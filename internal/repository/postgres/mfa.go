@@ -0,0 +1,354 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"time"
+)
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// GetUserMFA возвращает второй фактор пользователя или nil, если он не настраивался
+func (r *MFARepository) GetUserMFA(ctx context.Context, userID string) (*domain.UserMFA, error) {
+	const op = "repository.postgres.GetUserMFA"
+
+	query := `
+		SELECT user_id, totp_secret, enabled, last_used_step, failed_attempts, last_failed_at, created_at, enabled_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	var mfa domain.UserMFA
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.Enabled,
+		&mfa.LastUsedStep,
+		&mfa.FailedAttempts,
+		&mfa.LastFailedAt,
+		&mfa.CreatedAt,
+		&mfa.EnabledAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &mfa, nil
+}
+
+// IsMFAEnabled сообщает, включён ли у пользователя второй фактор
+func (r *MFARepository) IsMFAEnabled(ctx context.Context, userID string) (bool, error) {
+	const op = "repository.postgres.IsMFAEnabled"
+
+	var enabled bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled)`
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&enabled); err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return enabled, nil
+}
+
+// SavePendingMFA сохраняет новый секрет для подтверждения первым кодом.
+// Незавершённая настройка перезаписывается, включённый второй фактор - нет:
+// в этом случае возвращается domain.ErrMFAAlreadyEnabled
+func (r *MFARepository) SavePendingMFA(ctx context.Context, mfa *domain.UserMFA) error {
+	const op = "repository.postgres.SavePendingMFA"
+
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, created_at = EXCLUDED.created_at,
+		    last_used_step = 0, failed_attempts = 0, last_failed_at = NULL
+		WHERE NOT user_mfa.enabled
+	`
+
+	res, err := r.db.ExecContext(ctx, query, mfa.UserID, mfa.Secret, mfa.CreatedAt)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении секрета TOTP",
+			slog.String("user_id", mfa.UserID.String()),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+// EnableMFA в одной транзакции включает второй фактор, запоминает шаг подтверждающего
+// кода и заменяет коды восстановления новыми
+func (r *MFARepository) EnableMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (err error) {
+	const op = "repository.postgres.EnableMFA"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE user_mfa
+		SET enabled = TRUE, enabled_at = NOW(), last_used_step = $2, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = $1 AND NOT enabled
+	`
+	res, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error(op,
+			"ошибка при включении второго фактора",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteMFA отключает второй фактор и удаляет коды восстановления
+func (r *MFARepository) DeleteMFA(ctx context.Context, userID string) (err error) {
+	const op = "repository.postgres.DeleteMFA"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error(op,
+			"ошибка при отключении второго фактора",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep атомарно принимает код шага step: только если он новее последнего принятого.
+// false - код этого или более позднего шага уже использован
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	const op = "repository.postgres.UseTOTPStep"
+
+	query := `
+		UPDATE user_mfa
+		SET last_used_step = $2, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении шага TOTP",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected > 0, nil
+}
+
+// UseRecoveryCode атомарно гасит код восстановления. false - кода нет или он уже использован
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	const op = "repository.postgres.UseRecoveryCode"
+
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при погашении кода восстановления",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	query = `UPDATE user_mfa SET failed_attempts = 0, last_failed_at = NULL WHERE user_id = $1`
+	if _, err = r.db.ExecContext(ctx, query, userID); err != nil {
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// RecordMFAFailure учитывает неверный код. Ошибки старше window не считаются:
+// счётчик начинается заново
+func (r *MFARepository) RecordMFAFailure(ctx context.Context, userID string, window time.Duration) error {
+	const op = "repository.postgres.RecordMFAFailure"
+
+	query := `
+		UPDATE user_mfa
+		SET failed_attempts = CASE WHEN last_failed_at IS NULL OR last_failed_at < $2 THEN 1 ELSE failed_attempts + 1 END,
+		    last_failed_at = NOW()
+		WHERE user_id = $1
+	`
+	if _, err := r.db.ExecContext(ctx, query, userID, time.Now().Add(-window)); err != nil {
+		slog.Error(op,
+			"ошибка при учёте неверного кода",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления пользователя новыми
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) (err error) {
+	const op = "repository.postgres.ReplaceRecoveryCodes"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error(op,
+			"ошибка при замене кодов восстановления",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, db execer, userID string, codeHashes []string) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range codeHashes {
+		if _, err := db.ExecContext(ctx, query, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RedeemMFAChallenge отмечает токен MFA challenge jti использованным. false - токен уже
+// был использован. Запись хранится до expiresAt, после чего токен отклоняется и без неё
+func (r *MFARepository) RedeemMFAChallenge(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	const op = "repository.postgres.RedeemMFAChallenge"
+
+	query := `
+		INSERT INTO mfa_challenge_redemptions (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, jti, expiresAt)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при погашении токена MFA challenge",
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteExpiredMFAChallenges удаляет записи о погашенных токенах MFA challenge, срок которых истёк
+func (r *MFARepository) DeleteExpiredMFAChallenges(ctx context.Context) (int64, error) {
+	const op = "repository.postgres.DeleteExpiredMFAChallenges"
+
+	query := `DELETE FROM mfa_challenge_redemptions WHERE expires_at < NOW()`
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении погашенных токенов MFA challenge",
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,362 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// authorizationCodeRetention - сколько хранится использованный код авторизации после истечения
+const authorizationCodeRetention = 24 * time.Hour
+
+type OAuthRepository struct {
+	db *sql.DB
+}
+
+func NewOAuthRepository(db *sql.DB) *OAuthRepository {
+	return &OAuthRepository{db: db}
+}
+
+func (r *OAuthRepository) CreateOAuthClient(ctx context.Context, client *domain.OAuthClient) error {
+	const op = "repository.postgres.CreateOAuthClient"
+
+	query := `
+		INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, scopes, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		client.ID,
+		client.SecretHash,
+		client.Name,
+		strings.Join(client.RedirectURIs, " "),
+		strings.Join(client.Scopes, " "),
+		client.CreatedAt,
+	)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении OAuth клиента",
+			slog.String("client_id", client.ID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetOAuthClient возвращает клиента или nil, если он не зарегистрирован
+func (r *OAuthRepository) GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	const op = "repository.postgres.GetOAuthClient"
+
+	query := `
+		SELECT id, COALESCE(secret_hash, ''), name, redirect_uris, scopes, created_at
+		FROM oauth_clients
+		WHERE id = $1
+	`
+
+	var client domain.OAuthClient
+	err := scanOAuthClient(r.db.QueryRowContext(ctx, query, clientID), &client)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("client_id", clientID),
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &client, nil
+}
+
+// ListOAuthClients возвращает зарегистрированных клиентов, начиная с самого старого
+func (r *OAuthRepository) ListOAuthClients(ctx context.Context) ([]domain.OAuthClient, error) {
+	const op = "repository.postgres.ListOAuthClients"
+
+	query := `
+		SELECT id, COALESCE(secret_hash, ''), name, redirect_uris, scopes, created_at
+		FROM oauth_clients
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var clients []domain.OAuthClient
+	for rows.Next() {
+		var client domain.OAuthClient
+		if err = scanOAuthClient(rows, &client); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		clients = append(clients, client)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+// DeleteOAuthClient удаляет клиента вместе с его кодами авторизации и сессиями,
+// выданные клиенту refresh токены перестают действовать
+func (r *OAuthRepository) DeleteOAuthClient(ctx context.Context, clientID string) (_ bool, err error) {
+	const op = "repository.postgres.DeleteOAuthClient"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM oauth_clients WHERE id = $1`, clientID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении OAuth клиента",
+			slog.String("client_id", clientID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		_ = tx.Rollback()
+		return false, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM refresh_sessions WHERE client_id = $1`, clientID); err != nil {
+		slog.Error(op,
+			"ошибка при удалении сессий OAuth клиента",
+			slog.String("client_id", clientID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+func (r *OAuthRepository) SaveAuthorizationCode(ctx context.Context, code *domain.AuthorizationCode) error {
+	const op = "repository.postgres.SaveAuthorizationCode"
+
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, amr, code_challenge,
+		                                       created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		strings.Join(code.Scopes, " "),
+		strings.Join(code.AMR, " "),
+		code.CodeChallenge,
+		code.CreatedAt,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении кода авторизации",
+			slog.String("client_id", code.ClientID),
+			slog.String("user_id", code.UserID.String()),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode гасит действующий код и возвращает его. Использованный код хранится:
+// повторное предъявление (RFC 6749, раздел 4.1.2) отмечается и завершает сессию, выданную по коду,
+// результат - domain.ErrAuthorizationCodeReused. Неизвестный или истёкший код - nil
+func (r *OAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (_ *domain.AuthorizationCode, err error) {
+	const op = "repository.postgres.ConsumeAuthorizationCode"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `
+		SELECT code_hash, client_id, user_id, redirect_uri, scopes, amr, code_challenge, created_at, expires_at,
+		       used_at, family_id, expires_at > NOW()
+		FROM oauth_authorization_codes
+		WHERE code_hash = $1
+		FOR UPDATE
+	`
+
+	var code domain.AuthorizationCode
+	var scopes, amr, familyID string
+	var usedAt sql.NullTime
+	var active bool
+	err = tx.QueryRowContext(ctx, query, codeHash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&scopes,
+		&amr,
+		&code.CodeChallenge,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&usedAt,
+		&familyID,
+		&active,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при погашении кода авторизации",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case usedAt.Valid:
+		// Если сессия ещё не выпущена, её завершит BindAuthorizationCodeFamily по отметке reused_at
+		query = `UPDATE oauth_authorization_codes SET reused_at = NOW() WHERE code_hash = $1`
+		if _, err = tx.ExecContext(ctx, query, codeHash); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if familyID != "" {
+			if _, err = tx.ExecContext(ctx, `DELETE FROM refresh_sessions WHERE family_id = $1`, familyID); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return nil, domain.ErrAuthorizationCodeReused
+	case !active:
+		_ = tx.Rollback()
+		return nil, nil
+	}
+
+	query = `UPDATE oauth_authorization_codes SET used_at = NOW() WHERE code_hash = $1`
+	if _, err = tx.ExecContext(ctx, query, codeHash); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code.Scopes = strings.Fields(scopes)
+	code.AMR = strings.Fields(amr)
+	return &code, nil
+}
+
+// BindAuthorizationCodeFamily запоминает семейство сессии, выпущенной по коду, чтобы повторное
+// предъявление кода её завершило. Если код уже успели предъявить повторно или удалить вместе
+// с клиентом, сессия сразу завершается и возвращается false
+func (r *OAuthRepository) BindAuthorizationCodeFamily(ctx context.Context, codeHash, familyID string) (_ bool, err error) {
+	const op = "repository.postgres.BindAuthorizationCodeFamily"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Код мог быть удалён вместе с клиентом - тогда сессия тоже не нужна
+	reused := true
+	query := `UPDATE oauth_authorization_codes SET family_id = $2 WHERE code_hash = $1 RETURNING reused_at IS NOT NULL`
+	err = tx.QueryRowContext(ctx, query, codeHash, familyID).Scan(&reused)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении семейства сессии кода авторизации",
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if reused {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM refresh_sessions WHERE family_id = $1`, familyID); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return !reused, nil
+}
+
+// DeleteExpiredAuthorizationCodes удаляет неиспользованные истёкшие коды. Использованные коды
+// хранятся ещё authorizationCodeRetention после истечения, чтобы распознать их повторное предъявление
+func (r *OAuthRepository) DeleteExpiredAuthorizationCodes(ctx context.Context) (int64, error) {
+	const op = "repository.postgres.DeleteExpiredAuthorizationCodes"
+
+	query := `
+		DELETE FROM oauth_authorization_codes
+		WHERE expires_at < NOW() AND (used_at IS NULL OR expires_at < $1)
+	`
+	res, err := r.db.ExecContext(ctx, query, time.Now().Add(-authorizationCodeRetention))
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении истёкших кодов авторизации",
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.RowsAffected()
+}
+
+func scanOAuthClient(row rowScanner, client *domain.OAuthClient) error {
+	var redirectURIs, scopes string
+
+	err := row.Scan(
+		&client.ID,
+		&client.SecretHash,
+		&client.Name,
+		&redirectURIs,
+		&scopes,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.Scopes = strings.Fields(scopes)
+	return nil
+}
@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"time"
+)
+
+type OneTimeTokenRepository struct {
+	db *sql.DB
+}
+
+func NewOneTimeTokenRepository(db *sql.DB) *OneTimeTokenRepository {
+	return &OneTimeTokenRepository{db: db}
+}
+
+func (r *OneTimeTokenRepository) SaveOneTimeToken(ctx context.Context, token *domain.OneTimeToken) error {
+	const op = "repository.postgres.SaveOneTimeToken"
+
+	query := `
+		INSERT INTO one_time_tokens (token_hash, user_id, purpose, created_at, expires_at, nonce_hash, code_hash)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''))
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.TokenHash,
+		token.UserID,
+		token.Purpose,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.NonceHash,
+		token.CodeHash,
+	)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении одноразового токена",
+			slog.String("user_id", token.UserID.String()),
+			slog.String("purpose", token.Purpose),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeOneTimeToken атомарно гасит действующий токен и возвращает ID его пользователя.
+// Неизвестный, истёкший или уже использованный токен - пустая строка
+func (r *OneTimeTokenRepository) ConsumeOneTimeToken(ctx context.Context, tokenHash, purpose string) (string, error) {
+	const op = "repository.postgres.ConsumeOneTimeToken"
+
+	query := `
+		UPDATE one_time_tokens
+		SET consumed_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID string
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при погашении одноразового токена",
+			slog.String("purpose", purpose),
+			slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// ConsumeBoundOneTimeToken гасит токен из ссылки, только если он предъявлен с устройства,
+// запросившего вход (nonceHash). Иначе, как и для недействительного токена, - пустая строка
+func (r *OneTimeTokenRepository) ConsumeBoundOneTimeToken(ctx context.Context, tokenHash, nonceHash, purpose string) (string, error) {
+	const op = "repository.postgres.ConsumeBoundOneTimeToken"
+
+	query := `
+		UPDATE one_time_tokens
+		SET consumed_at = NOW()
+		WHERE token_hash = $1 AND nonce_hash = $2 AND purpose = $3 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID string
+	err := r.db.QueryRowContext(ctx, query, tokenHash, nonceHash, purpose).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при погашении одноразового токена",
+			slog.String("purpose", purpose),
+			slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// ConsumeOneTimeCode проверяет код из письма для устройства nonceHash. Каждая проверка расходует
+// попытку, после maxAttempts код не принимается. Верный код гасит токен вместе со ссылкой.
+// К одному устройству может быть привязано несколько писем, код ищется среди всех.
+// Неверный код, недействительный токен или исчерпанные попытки - пустая строка
+func (r *OneTimeTokenRepository) ConsumeOneTimeCode(ctx context.Context, nonceHash, codeHash, purpose string, maxAttempts int) (string, error) {
+	const op = "repository.postgres.ConsumeOneTimeCode"
+
+	query := `
+		UPDATE one_time_tokens
+		SET attempts = attempts + 1,
+		    consumed_at = CASE WHEN code_hash = $2 THEN NOW() END
+		WHERE nonce_hash = $1 AND purpose = $3 AND consumed_at IS NULL AND expires_at > NOW() AND attempts < $4
+		RETURNING user_id, consumed_at IS NOT NULL
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, nonceHash, codeHash, purpose, maxAttempts)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при проверке одноразового кода",
+			slog.String("purpose", purpose),
+			slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var userID string
+	for rows.Next() {
+		var candidate string
+		var consumed bool
+		if err = rows.Scan(&candidate, &consumed); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if consumed {
+			userID = candidate
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// CountRecentOneTimeTokens возвращает число токенов пользователя, выпущенных после since,
+// и время выпуска последнего из них - для ограничения частоты писем
+func (r *OneTimeTokenRepository) CountRecentOneTimeTokens(ctx context.Context, userID, purpose string, since time.Time) (int, *time.Time, error) {
+	const op = "repository.postgres.CountRecentOneTimeTokens"
+
+	query := `
+		SELECT COUNT(*), MAX(created_at) FROM one_time_tokens
+		WHERE user_id = $1 AND purpose = $2 AND created_at > $3
+	`
+
+	var count int
+	var lastCreatedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID, purpose, since).Scan(&count, &lastCreatedAt)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !lastCreatedAt.Valid {
+		return count, nil, nil
+	}
+	return count, &lastCreatedAt.Time, nil
+}
+
+// DeleteOneTimeTokens удаляет все токены пользователя с данным назначением,
+// например оставшиеся ссылки после подтверждения email
+func (r *OneTimeTokenRepository) DeleteOneTimeTokens(ctx context.Context, userID, purpose string) error {
+	const op = "repository.postgres.DeleteOneTimeTokens"
+
+	query := `DELETE FROM one_time_tokens WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, userID, purpose); err != nil {
+		slog.Error(op,
+			"ошибка при удалении одноразовых токенов",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredOneTimeTokens удаляет истёкшие токены
+func (r *OneTimeTokenRepository) DeleteExpiredOneTimeTokens(ctx context.Context) (int64, error) {
+	const op = "repository.postgres.DeleteExpiredOneTimeTokens"
+
+	query := `DELETE FROM one_time_tokens WHERE expires_at < NOW()`
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении истёкших одноразовых токенов",
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.RowsAffected()
+}
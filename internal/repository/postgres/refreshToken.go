@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"github.com/medods/auth-service/internal/domain"
 	"log/slog"
+	"slices"
+	"strings"
 )
 
 type RefreshTokenRepository struct {
@@ -17,32 +19,77 @@ func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
 	return &RefreshTokenRepository{db: db}
 }
 
-func (r *RefreshTokenRepository) SaveRefreshSession(ctx context.Context, session *domain.RefreshSession) error {
+// SaveRefreshSession сохраняет сессию нового входа, не превышая лимит maxSessions: самые старые
+// действующие сессии пользователя завершаются вместе с семействами. Входы одного пользователя
+// выполняются последовательно под advisory lock транзакции, поэтому параллельные входы
+// не обходят лимит. Возвращает семейства завершённых сессий
+func (r *RefreshTokenRepository) SaveRefreshSession(ctx context.Context, session *domain.RefreshSession, maxSessions int) (_ []string, err error) {
 	const op = "repository.postgres.SaveRefreshSession"
 
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	userID := session.UserID.String()
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Новая сессия займёт одно место, поэтому остаются maxSessions-1 самых новых
 	query := `
-		INSERT INTO refresh_sessions (id, user_id, token_hash, user_ip, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		DELETE FROM refresh_sessions
+		WHERE family_id IN (
+			SELECT family_id FROM refresh_sessions
+			WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > NOW()
+			ORDER BY created_at DESC
+			OFFSET $2
+		)
+		RETURNING family_id
 	`
+	rows, err := tx.QueryContext(ctx, query, userID, max(maxSessions-1, 0))
+	if err != nil {
+		slog.Error(op,
+			"ошибка при завершении старых сессий",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-	_, err := r.db.ExecContext(ctx, query,
-		session.ID,
-		session.UserID,
-		session.TokenHash,
-		session.UserIP,
-		session.CreatedAt,
-		session.ExpiresAt,
-	)
+	var evicted []string
+	for rows.Next() {
+		var familyID string
+		if err = rows.Scan(&familyID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !slices.Contains(evicted, familyID) {
+			evicted = append(evicted, familyID)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-	if err != nil {
+	if err = insertSession(ctx, tx, session); err != nil {
 		slog.Error(op,
 			"ошибка при сохранении сессии",
-			slog.String("user_id", session.UserID.String()),
+			slog.String("user_id", userID),
 			slog.String("error", err.Error()))
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return evicted, nil
 }
 
 func (r *RefreshTokenRepository) GetRefreshSession(ctx context.Context, refreshID string) (*domain.RefreshSession, error) {
@@ -50,19 +97,13 @@ func (r *RefreshTokenRepository) GetRefreshSession(ctx context.Context, refreshI
 
 	var session domain.RefreshSession
 	query := `
-		SELECT id, user_id, token_hash, user_ip, created_at, expires_at
+		SELECT id, family_id, user_id, token_hash, user_ip, user_agent, scopes, amr, client_id, created_at, last_used_at,
+		       expires_at, consumed_at, successor_tokens
 		FROM refresh_sessions
 		WHERE id = $1
 	`
 
-	err := r.db.QueryRowContext(ctx, query, refreshID).Scan(
-		&session.ID,
-		&session.UserID,
-		&session.TokenHash,
-		&session.UserIP,
-		&session.CreatedAt,
-		&session.ExpiresAt,
-	)
+	err := scanSession(r.db.QueryRowContext(ctx, query, refreshID), &session)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -74,15 +115,48 @@ func (r *RefreshTokenRepository) GetRefreshSession(ctx context.Context, refreshI
 	return &session, nil
 }
 
-func (r *RefreshTokenRepository) DeleteRefreshSession(ctx context.Context, refreshID string) error {
-	const op = "repository.postgres.DeleteRefreshSession"
+// RotateRefreshSession в одной транзакции блокирует сессию (SELECT ... FOR UPDATE),
+// гасит её, оставляя надгробием, и сохраняет сессию-преемника. Из двух одновременных
+// ротаций одной сессии успешна только одна, вторая получает domain.ErrTokenReused
+func (r *RefreshTokenRepository) RotateRefreshSession(ctx context.Context, refreshID string, next *domain.RefreshSession, successorTokens []byte) (err error) {
+	const op = "repository.postgres.RotateRefreshSession"
 
-	query := `DELETE FROM refresh_sessions WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, refreshID)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
+	var consumedAt sql.NullTime
+	query := `SELECT consumed_at FROM refresh_sessions WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, refreshID).Scan(&consumedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrSessionNotFound
+	}
 	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if consumedAt.Valid {
+		return domain.ErrTokenReused
+	}
+
+	query = `UPDATE refresh_sessions SET consumed_at = NOW(), successor_tokens = $2 WHERE id = $1`
+	if _, err = tx.ExecContext(ctx, query, refreshID, successorTokens); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = insertSession(ctx, tx, next); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
 		slog.Error(op,
-			"ошибка при сохранении сессии",
+			"ошибка при ротации сессии",
+			slog.String("refresh_id", refreshID),
 			slog.String("error", err.Error()))
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -90,21 +164,180 @@ func (r *RefreshTokenRepository) DeleteRefreshSession(ctx context.Context, refre
 	return nil
 }
 
-func (r *RefreshTokenRepository) FindSessionByUserID(ctx context.Context, userID string) (bool, error) {
-	const op = "repository.postgres.FindSessionByUserID"
+// DeleteSessionFamily удаляет все сессии семейства вместе с надгробиями
+func (r *RefreshTokenRepository) DeleteSessionFamily(ctx context.Context, familyID string) (int64, error) {
+	const op = "repository.postgres.DeleteSessionFamily"
+
+	query := `DELETE FROM refresh_sessions WHERE family_id = $1`
+	res, err := r.db.ExecContext(ctx, query, familyID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении семейства сессий",
+			slog.String("family_id", familyID),
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 
-	var count int
+	return res.RowsAffected()
+}
 
-	query := `SELECT COUNT(*) FROM refresh_sessions WHERE user_id = $1`
+// DeleteExpiredSessions удаляет истёкшие сессии и надгробия
+func (r *RefreshTokenRepository) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	const op = "repository.postgres.DeleteExpiredSessions"
 
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	query := `DELETE FROM refresh_sessions WHERE expires_at < NOW()`
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении истёкших сессий",
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.RowsAffected()
+}
+
+// ListSessionsByUserID возвращает действующие сессии пользователя, начиная с самой старой
+func (r *RefreshTokenRepository) ListSessionsByUserID(ctx context.Context, userID string) ([]domain.RefreshSession, error) {
+	const op = "repository.postgres.ListSessionsByUserID"
+
+	query := `
+		SELECT id, family_id, user_id, token_hash, user_ip, user_agent, scopes, amr, client_id, created_at, last_used_at,
+		       expires_at, consumed_at, successor_tokens
+		FROM refresh_sessions
+		WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		slog.Error(op,
 			"ошибка при получени данных с базы",
 			slog.String("user_id", userID),
 			slog.String("error", err.Error()))
-		return false, err
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []domain.RefreshSession
+	for rows.Next() {
+		var session domain.RefreshSession
+		if err = scanSession(rows, &session); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSession удаляет сессию вместе с её семейством, только если она принадлежит пользователю
+func (r *RefreshTokenRepository) DeleteUserSession(ctx context.Context, userID, refreshID string) (bool, error) {
+	const op = "repository.postgres.DeleteUserSession"
+
+	query := `
+		DELETE FROM refresh_sessions
+		WHERE family_id = (
+			SELECT family_id FROM refresh_sessions
+			WHERE id = $1 AND user_id = $2 AND consumed_at IS NULL
+		)
+	`
+	res, err := r.db.ExecContext(ctx, query, refreshID, userID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении сессии",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteSessionsByUserID удаляет все сессии пользователя и возвращает их количество
+func (r *RefreshTokenRepository) DeleteSessionsByUserID(ctx context.Context, userID string) (int64, error) {
+	const op = "repository.postgres.DeleteSessionsByUserID"
+
+	query := `DELETE FROM refresh_sessions WHERE user_id = $1`
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении сессий",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return count > 0, nil
+	return res.RowsAffected()
+}
+
+// execer - общий интерфейс *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertSession(ctx context.Context, db execer, session *domain.RefreshSession) error {
+	query := `
+		INSERT INTO refresh_sessions (id, family_id, user_id, token_hash, user_ip, user_agent, scopes, amr, client_id, created_at,
+		                              last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	_, err := db.ExecContext(ctx, query,
+		session.ID,
+		session.FamilyID,
+		session.UserID,
+		session.TokenHash,
+		session.UserIP,
+		session.UserAgent,
+		strings.Join(session.Scopes, " "),
+		strings.Join(session.AMR, " "),
+		session.ClientID,
+		session.CreatedAt,
+		session.LastUsedAt,
+		session.ExpiresAt,
+	)
+	return err
+}
+
+// rowScanner - общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner, session *domain.RefreshSession) error {
+	var scopes, amr string
+
+	err := row.Scan(
+		&session.ID,
+		&session.FamilyID,
+		&session.UserID,
+		&session.TokenHash,
+		&session.UserIP,
+		&session.UserAgent,
+		&scopes,
+		&amr,
+		&session.ClientID,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.ConsumedAt,
+		&session.SuccessorTokens,
+	)
+	if err != nil {
+		return err
+	}
+
+	session.Scopes = strings.Fields(scopes)
+	session.AMR = strings.Fields(amr)
+	return nil
 }
@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolation = "23505"
+
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// CreateUser сохраняет пользователя, занятый email - domain.ErrUserExists
+func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	const op = "repository.postgres.CreateUser"
+
+	query := `
+		INSERT INTO users (id, email, email_verified, password_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		user.ID,
+		user.Email,
+		user.EmailVerified,
+		user.PasswordHash,
+		user.CreatedAt,
+		user.UpdatedAt,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return domain.ErrUserExists
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении пользователя",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetUserByEmail возвращает пользователя или nil, если email не зарегистрирован
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	const op = "repository.postgres.GetUserByEmail"
+
+	query := `
+		SELECT id, email, email_verified, password_hash, created_at, updated_at
+		FROM users
+		WHERE email = $1
+	`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// GetUserByID возвращает пользователя или nil, если его нет
+func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*domain.User, error) {
+	const op = "repository.postgres.GetUserByID"
+
+	query := `
+		SELECT id, email, email_verified, password_hash, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// UpdatePasswordHash заменяет хеш пароля, например при переходе с bcrypt на Argon2id
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error {
+	const op = "repository.postgres.UpdatePasswordHash"
+
+	query := `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, userID, passwordHash); err != nil {
+		slog.Error(op,
+			"ошибка при обновлении хеша пароля",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetPasswordByToken в одной транзакции гасит токен сброса пароля и устанавливает новый хеш:
+// если обновление не удалось, ссылка остаётся действительной. Переход по ссылке из письма заодно
+// подтверждает email, остальные ссылки сброса удаляются. Возвращает ID пользователя.
+// Неизвестный, истёкший или уже использованный токен - domain.ErrInvalidOneTimeToken
+func (r *UserRepository) ResetPasswordByToken(ctx context.Context, tokenHash, passwordHash string) (_ string, err error) {
+	const op = "repository.postgres.ResetPasswordByToken"
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE one_time_tokens
+		SET consumed_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID string
+	err = tx.QueryRowContext(ctx, query, tokenHash, domain.TokenPurposePasswordReset).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.ErrInvalidOneTimeToken
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при погашении токена сброса пароля",
+			slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `UPDATE users SET password_hash = $2, email_verified = TRUE, updated_at = NOW() WHERE id = $1`
+	if _, err = tx.ExecContext(ctx, query, userID, passwordHash); err != nil {
+		slog.Error(op,
+			"ошибка при обновлении хеша пароля",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `DELETE FROM one_time_tokens WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL`
+	if _, err = tx.ExecContext(ctx, query, userID, domain.TokenPurposePasswordReset); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// MarkEmailVerified отмечает email пользователя подтверждённым
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	const op = "repository.postgres.MarkEmailVerified"
+
+	query := `UPDATE users SET email_verified = TRUE, updated_at = NOW() WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		slog.Error(op,
+			"ошибка при подтверждении email",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	var user domain.User
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.EmailVerified,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,282 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type WebAuthnRepository struct {
+	db *sql.DB
+}
+
+func NewWebAuthnRepository(db *sql.DB) *WebAuthnRepository {
+	return &WebAuthnRepository{db: db}
+}
+
+// SaveWebAuthnCredential сохраняет ключ доступа, уже зарегистрированный ключ - domain.ErrWebAuthnCredentialExists
+func (r *WebAuthnRepository) SaveWebAuthnCredential(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	const op = "repository.postgres.SaveWebAuthnCredential"
+
+	query := `
+		INSERT INTO webauthn_credentials (id, user_id, name, public_key, attestation_type, transports, aaguid,
+		                                  sign_count, backup_eligible, backup_state, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.PublicKey,
+		credential.AttestationType,
+		strings.Join(credential.Transports, " "),
+		credential.AAGUID,
+		int64(credential.SignCount),
+		credential.BackupEligible,
+		credential.BackupState,
+		credential.CreatedAt,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return domain.ErrWebAuthnCredentialExists
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении ключа доступа",
+			slog.String("user_id", credential.UserID.String()),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetWebAuthnCredential возвращает ключ доступа или nil, если он не зарегистрирован
+func (r *WebAuthnRepository) GetWebAuthnCredential(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error) {
+	const op = "repository.postgres.GetWebAuthnCredential"
+
+	query := `
+		SELECT id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count,
+		       backup_eligible, backup_state, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE id = $1
+	`
+
+	var credential domain.WebAuthnCredential
+	err := scanWebAuthnCredential(r.db.QueryRowContext(ctx, query, credentialID), &credential)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &credential, nil
+}
+
+// ListWebAuthnCredentials возвращает ключи доступа пользователя, начиная с самого старого
+func (r *WebAuthnRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]domain.WebAuthnCredential, error) {
+	const op = "repository.postgres.ListWebAuthnCredentials"
+
+	query := `
+		SELECT id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count,
+		       backup_eligible, backup_state, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получени данных с базы",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var credentials []domain.WebAuthnCredential
+	for rows.Next() {
+		var credential domain.WebAuthnCredential
+		if err = scanWebAuthnCredential(rows, &credential); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return credentials, nil
+}
+
+// UseWebAuthnCredential сохраняет новый счётчик подписей после входа. Счётчик должен расти,
+// кроме ключей, которые его не ведут (всегда 0). false - счётчик не вырос: ключ мог быть клонирован
+// или та же подпись предъявлена повторно
+func (r *WebAuthnRepository) UseWebAuthnCredential(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) (bool, error) {
+	const op = "repository.postgres.UseWebAuthnCredential"
+
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $2, backup_state = $3, last_used_at = NOW()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))
+	`
+	res, err := r.db.ExecContext(ctx, query, credentialID, int64(signCount), backupState)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при обновлении ключа доступа",
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteWebAuthnCredential удаляет ключ доступа, только если он принадлежит пользователю
+func (r *WebAuthnRepository) DeleteWebAuthnCredential(ctx context.Context, userID string, credentialID []byte) (bool, error) {
+	const op = "repository.postgres.DeleteWebAuthnCredential"
+
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+	res, err := r.db.ExecContext(ctx, query, credentialID, userID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении ключа доступа",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *WebAuthnRepository) SaveWebAuthnCeremony(ctx context.Context, ceremony *domain.WebAuthnCeremony) error {
+	const op = "repository.postgres.SaveWebAuthnCeremony"
+
+	query := `
+		INSERT INTO webauthn_ceremonies (id_hash, user_id, purpose, session_data, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		ceremony.IDHash,
+		ceremony.UserID,
+		ceremony.Purpose,
+		ceremony.SessionData,
+		ceremony.CreatedAt,
+		ceremony.ExpiresAt,
+	)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при сохранении церемонии WebAuthn",
+			slog.String("purpose", ceremony.Purpose),
+			slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnCeremony атомарно удаляет действующую церемонию и возвращает её.
+// Неизвестная, истёкшая или уже завершённая церемония - nil
+func (r *WebAuthnRepository) ConsumeWebAuthnCeremony(ctx context.Context, idHash, purpose string) (*domain.WebAuthnCeremony, error) {
+	const op = "repository.postgres.ConsumeWebAuthnCeremony"
+
+	query := `
+		DELETE FROM webauthn_ceremonies
+		WHERE id_hash = $1 AND purpose = $2 AND expires_at > NOW()
+		RETURNING id_hash, user_id, purpose, session_data, created_at, expires_at
+	`
+
+	var ceremony domain.WebAuthnCeremony
+	var userID uuid.NullUUID
+	err := r.db.QueryRowContext(ctx, query, idHash, purpose).Scan(
+		&ceremony.IDHash,
+		&userID,
+		&ceremony.Purpose,
+		&ceremony.SessionData,
+		&ceremony.CreatedAt,
+		&ceremony.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error(op,
+			"ошибка при завершении церемонии WebAuthn",
+			slog.String("purpose", purpose),
+			slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if userID.Valid {
+		ceremony.UserID = &userID.UUID
+	}
+	return &ceremony, nil
+}
+
+// DeleteExpiredWebAuthnCeremonies удаляет брошенные церемонии
+func (r *WebAuthnRepository) DeleteExpiredWebAuthnCeremonies(ctx context.Context) (int64, error) {
+	const op = "repository.postgres.DeleteExpiredWebAuthnCeremonies"
+
+	query := `DELETE FROM webauthn_ceremonies WHERE expires_at < NOW()`
+	res, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при удалении истёкших церемоний WebAuthn",
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.RowsAffected()
+}
+
+func scanWebAuthnCredential(row rowScanner, credential *domain.WebAuthnCredential) error {
+	var transports string
+	var signCount int64
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.Name,
+		&credential.PublicKey,
+		&credential.AttestationType,
+		&transports,
+		&credential.AAGUID,
+		&signCount,
+		&credential.BackupEligible,
+		&credential.BackupState,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	credential.Transports = strings.Fields(transports)
+	credential.SignCount = uint32(signCount)
+	return nil
+}
@@ -2,24 +2,32 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/medods/auth-service/internal/domain"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
 	"github.com/medods/auth-service/pkg/jwt"
 )
 
 type AuthTokenRepo interface {
-	SaveRefreshSession(ctx context.Context, session *domain.RefreshSession) error
+	SaveRefreshSession(ctx context.Context, session *domain.RefreshSession, maxSessions int) ([]string, error)
 	GetRefreshSession(ctx context.Context, refreshID string) (*domain.RefreshSession, error)
-	DeleteRefreshSession(ctx context.Context, refreshToken string) error
-	FindSessionByUserID(ctx context.Context, userID string) (bool, error)
+	RotateRefreshSession(ctx context.Context, refreshID string, next *domain.RefreshSession, successorTokens []byte) error
+	DeleteSessionFamily(ctx context.Context, familyID string) (int64, error)
+	ListSessionsByUserID(ctx context.Context, userID string) ([]domain.RefreshSession, error)
+	DeleteUserSession(ctx context.Context, userID, refreshID string) (bool, error)
+	DeleteSessionsByUserID(ctx context.Context, userID string) (int64, error)
 }
 
 type TokenManager interface {
-	GenerateTokenPair(userID uuid.UUID, userIP string) (jwt.TokenPair, string, error)
+	GenerateTokenPair(grant jwt.Grant) (jwt.TokenPair, string, error)
+	GenerateMFAToken(grant jwt.Grant, ttl time.Duration) (string, error)
 	HashRefreshToken(refreshToken string) (string, error)
 	CompareRefreshToken(hash, refreshToken string) error
 
@@ -30,6 +38,11 @@ type TokenManager interface {
 	GetRefreshTTL() time.Duration
 }
 
+// MFAStatusRepo сообщает, нужен ли пользователю второй фактор при входе
+type MFAStatusRepo interface {
+	IsMFAEnabled(ctx context.Context, userID string) (bool, error)
+}
+
 type SMTPManager interface {
 	SendAlert(subject, body string) error
 }
@@ -38,40 +51,133 @@ type AuthUseCase struct {
 	tokenManager    TokenManager
 	tokenRepository AuthTokenRepo
 	emailSender     SMTPManager
+	claimsProvider  ClaimsProvider
+	mfaRepository   MFAStatusRepo
+	mfaChallengeTTL time.Duration // срок действия токена MFA challenge
+	maxSessions     int           // максимум одновременных сессий (устройств) на пользователя
+	gracePeriod     time.Duration // сколько погашенный refresh токен возвращает пару преемника
 }
 
-func NewAuthUseCase(tokenManager *jwt.TokenManager, tokenRepo AuthTokenRepo, emailSender SMTPManager) *AuthUseCase {
+func NewAuthUseCase(
+	tokenManager *jwt.TokenManager,
+	tokenRepo AuthTokenRepo,
+	emailSender SMTPManager,
+	claimsProvider ClaimsProvider,
+	mfaRepo MFAStatusRepo,
+	sessionCfg config.SessionConfig,
+	mfaCfg config.MFAConfig,
+) *AuthUseCase {
 	return &AuthUseCase{
 		tokenManager:    tokenManager,
 		tokenRepository: tokenRepo,
 		emailSender:     emailSender,
+		claimsProvider:  claimsProvider,
+		mfaRepository:   mfaRepo,
+		mfaChallengeTTL: mfaCfg.ChallengeTTL,
+		maxSessions:     sessionCfg.MaxPerUser,
+		gracePeriod:     sessionCfg.RefreshGracePeriod,
 	}
 }
 
-func (uc *AuthUseCase) GenerateTokens(ctx context.Context, userID uuid.UUID, userIP string) (*jwt.TokenPair, error) {
+// GenerateTokens открывает новую сессию. scopes проверяются по правам пользователя,
+// пустой список означает все разрешённые ему scopes. amr - пройденные методы аутентификации.
+// Если у пользователя включён второй фактор, а amr не содержит jwt.AMRMultiFactor,
+// сессия не открывается: возвращается *domain.MFAChallenge
+func (uc *AuthUseCase) GenerateTokens(ctx context.Context, userID uuid.UUID, scopes, amr []string, client domain.ClientInfo) (*jwt.TokenPair, error) {
 	const op = "usecase.auth.GenerateTokens"
 
-	sessionExists, err := uc.tokenRepository.FindSessionByUserID(ctx, userID.String())
+	userClaims, err := uc.claimsProvider.UserClaims(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("внутренняя ошибка при проверке сессии пользователя")
+		slog.Error(op, "ошибка при получении прав пользователя", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при получении прав пользователя")
 	}
 
-	if sessionExists {
-		slog.Warn(op,
-			"сессия для пользователя уже существует",
+	granted, err := userClaims.GrantScopes(scopes)
+	if err != nil {
+		slog.Warn(op, "запрошены недоступные scopes",
 			slog.String("userID", userID.String()),
+			slog.Any("scopes", scopes),
 		)
-		return nil, nil
+		return nil, err
+	}
+
+	if !slices.Contains(amr, jwt.AMRMultiFactor) {
+		if err = uc.requireMFA(ctx, userID, granted, amr); err != nil {
+			return nil, err
+		}
+	}
+
+	base := domain.RefreshSession{UserID: userID, Scopes: granted, AMR: amr, CreatedAt: time.Now()}
+	tokenPair, session, err := uc.newSession(base, client, userClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Если пользователь достиг лимита устройств, самые старые сессии завершаются
+	evicted, err := uc.tokenRepository.SaveRefreshSession(ctx, session, uc.maxSessions)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при сохранении сессии")
+	}
+	for _, familyID := range evicted {
+		slog.Info(op,
+			"превышен лимит сессий, самая старая сессия завершена",
+			slog.String("userID", userID.String()),
+			slog.String("family_id", familyID),
+		)
+	}
+
+	return tokenPair, nil
+}
+
+// requireMFA возвращает *domain.MFAChallenge, если у пользователя включён второй фактор.
+// Токен challenge несёт выданные scopes и пройденные методы, чтобы после проверки кода
+// открыть сессию с теми же правами
+func (uc *AuthUseCase) requireMFA(ctx context.Context, userID uuid.UUID, scopes, amr []string) error {
+	const op = "usecase.auth.requireMFA"
+
+	enabled, err := uc.mfaRepository.IsMFAEnabled(ctx, userID.String())
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+	}
+	if !enabled {
+		return nil
 	}
 
-	tokenPair, refreshID, err := uc.tokenManager.GenerateTokenPair(userID, userIP)
+	token, err := uc.tokenManager.GenerateMFAToken(jwt.Grant{UserID: userID, Scopes: scopes, AMR: amr}, uc.mfaChallengeTTL)
+	if err != nil {
+		slog.Error(op, "ошибка генерации токена MFA challenge", slog.String("error", err.Error()))
+		return fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+	}
+
+	slog.Info(op, "требуется второй фактор", slog.String("userID", userID.String()))
+	return &domain.MFAChallenge{Token: token, ExpiresIn: int64(uc.mfaChallengeTTL.Seconds())}
+}
+
+// newSession выпускает пару токенов и готовит к сохранению их сессию.
+// Из base берутся пользователь, выданные scopes, методы аутентификации, семейство и время входа - при обновлении
+// токенов они переносятся из прежней сессии. Пустой FamilyID открывает новое семейство
+func (uc *AuthUseCase) newSession(base domain.RefreshSession, client domain.ClientInfo, userClaims *domain.UserClaims) (*jwt.TokenPair, *domain.RefreshSession, error) {
+	const op = "usecase.auth.newSession"
+
+	userID, familyID := base.UserID, base.FamilyID
+
+	tokenPair, refreshID, err := uc.tokenManager.GenerateTokenPair(jwt.Grant{
+		UserID:   userID,
+		UserIP:   client.IP,
+		Scopes:   base.Scopes,
+		Roles:    userClaims.Roles,
+		AMR:      base.AMR,
+		AuthTime: base.CreatedAt,
+		ClientID: client.ClientID,
+		Custom:   userClaims.Custom,
+	})
 	if err != nil {
 		slog.Error(op,
 			"ошибка генерации токенов",
 			slog.String("error", err.Error()),
 			slog.Any("userID", userID),
 		)
-		return nil, err
+		return nil, nil, err
 	}
 
 	ttlRefresh := uc.tokenManager.GetRefreshTTL()
@@ -83,34 +189,40 @@ func (uc *AuthUseCase) GenerateTokens(ctx context.Context, userID uuid.UUID, use
 			slog.String("error", err.Error()),
 			slog.Any("userID", userID),
 		)
-		return nil, err
+		return nil, nil, err
 	}
 
-	session := &domain.RefreshSession{
-		ID:        refreshID,                  // Связь сессии через UUID
-		UserID:    userID,                     // ID пользователя (UUID)
-		TokenHash: refreshHash,                // Захешированный refresh токен
-		UserIP:    userIP,                     // IP пользователя
-		ExpiresAt: time.Now().Add(ttlRefresh), // Срок действия
-		CreatedAt: time.Now(),                 // Время создания
+	if familyID == "" {
+		familyID = refreshID
 	}
 
-	if err = uc.tokenRepository.SaveRefreshSession(ctx, session); err != nil {
-		return nil, err
+	now := time.Now()
+	session := &domain.RefreshSession{
+		ID:         refreshID,           // Связь сессии через UUID
+		FamilyID:   familyID,            // Семейство сессий одного входа
+		UserID:     userID,              // ID пользователя (UUID)
+		TokenHash:  refreshHash,         // Захешированный refresh токен
+		UserIP:     client.IP,           // IP пользователя
+		UserAgent:  client.UserAgent,    // User-Agent устройства
+		Scopes:     base.Scopes,         // Выданные scopes
+		AMR:        base.AMR,            // Методы аутентификации при входе
+		ClientID:   client.ClientID,     // OAuth клиент
+		ExpiresAt:  now.Add(ttlRefresh), // Срок действия
+		CreatedAt:  base.CreatedAt,      // Время входа на устройстве
+		LastUsedAt: now,                 // Время последнего использования
 	}
 
-	return &tokenPair, nil
+	return &tokenPair, session, nil
 }
 
-func (uc *AuthUseCase) RefreshTokens(ctx context.Context, refreshToken string, userIP string) (*jwt.TokenPair, error) {
+func (uc *AuthUseCase) RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (*jwt.TokenPair, error) {
 	const op = "usecase.auth.RefreshTokens"
 
 	refreshClaim, err := uc.tokenManager.ParseRefreshToken(refreshToken)
 	if err != nil {
-		slog.Error(op,
+		slog.Warn(op,
 			"ошибка при парсинге токена",
 			slog.String("error", err.Error()),
-			slog.Any("refreshToken", refreshToken),
 		)
 		return nil, err
 	}
@@ -125,38 +237,313 @@ func (uc *AuthUseCase) RefreshTokens(ctx context.Context, refreshToken string, u
 	}
 
 	if session == nil {
-		slog.Warn(op, "сессия refresh токена не найдена")
+		slog.Warn(op, "сессия refresh токена не найдена", slog.String("refresh_id", refreshClaim.RefreshID))
 		return nil, fmt.Errorf("refresh токен не найден")
 	}
 
 	if err = uc.tokenManager.CompareRefreshToken(session.TokenHash, refreshToken); err != nil {
-		slog.Warn(op, "несоответствие refresh токена", slog.String("refresh_token", refreshToken))
+		slog.Warn(op, "несоответствие refresh токена", slog.String("refresh_id", session.ID))
 		return nil, fmt.Errorf("неверный refresh токен")
 	}
 
+	// Сессию стороннего приложения обновляет только оно само через /oauth/token, а собственную сессию
+	// сервиса нельзя обновить от имени OAuth клиента
+	if session.ClientID != client.ClientID {
+		slog.Warn(op,
+			"refresh токен предъявлен другим клиентом",
+			slog.String("refresh_id", session.ID),
+			slog.String("session_client_id", session.ClientID),
+			slog.String("client_id", client.ClientID),
+		)
+		return nil, fmt.Errorf("refresh токен выдан другому клиенту")
+	}
+
+	if session.ConsumedAt != nil {
+		// Параллельный запрос того же клиента (вкладка браузера, мобильное приложение)
+		if pair, ok := uc.gracePair(session, refreshToken, client); ok {
+			slog.Info(op, "погашенный токен предъявлен в grace период", slog.String("refresh_id", session.ID))
+			return pair, nil
+		}
+
+		uc.revokeReusedFamily(ctx, session, client)
+		return nil, domain.ErrTokenReused
+	}
+
 	if time.Now().After(session.ExpiresAt) {
-		_ = uc.tokenRepository.DeleteRefreshSession(ctx, refreshToken)
+		_, _ = uc.tokenRepository.DeleteSessionFamily(ctx, session.FamilyID)
 
-		slog.Warn(op, "refresh токен истёк", slog.String("refresh_token", refreshToken))
+		slog.Warn(op, "refresh токен истёк", slog.String("refresh_id", session.ID))
 		return nil, fmt.Errorf("refresh токен истёк")
 	}
 
-	if session.UserIP != userIP {
+	if session.UserIP != client.IP {
 		slog.Warn(op,
 			"несоответствие IP адреса",
 			slog.String("stored_ip", session.UserIP),
-			slog.String("current_ip", userIP),
+			slog.String("current_ip", client.IP),
 		)
 
-		err = uc.emailSender.SendAlert("Предупреждение: Несоответствие IP", fmt.Sprintf("IP адрес для токена %s изменился. Старый: %s, Новый: %s", refreshToken, session.UserIP, userIP))
+		err = uc.emailSender.SendAlert("Предупреждение: Несоответствие IP", fmt.Sprintf("IP адрес для сессии %s изменился. Старый: %s, Новый: %s", session.ID, session.UserIP, client.IP))
 		if err != nil {
 			slog.Error(op, "не удалось отправить уведомление", slog.String("error", err.Error()))
 		}
 	}
 
-	if err = uc.tokenRepository.DeleteRefreshSession(ctx, refreshClaim.RefreshID); err != nil {
-		return nil, fmt.Errorf("внутренняя ошибка при удалении старой сессии")
+	// Права могли измениться с момента входа: роли перечитываются, а scopes сужаются до разрешённых
+	userClaims, err := uc.claimsProvider.UserClaims(ctx, session.UserID)
+	if err != nil {
+		slog.Error(op, "ошибка при получении прав пользователя", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при получении прав пользователя")
+	}
+
+	base := domain.RefreshSession{
+		UserID:    session.UserID,
+		FamilyID:  session.FamilyID,
+		Scopes:    userClaims.NarrowScopes(session.Scopes),
+		AMR:       session.AMR,
+		CreatedAt: session.CreatedAt,
+	}
+	tokenPair, next, err := uc.newSession(base, client, userClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed []byte
+	if uc.gracePeriod > 0 {
+		if sealed, err = sealSuccessor(refreshToken, tokenPair, client.IP); err != nil {
+			return nil, fmt.Errorf("внутренняя ошибка при ротации сессии")
+		}
+	}
+
+	// Старая сессия остаётся надгробием: повторное предъявление её токена - признак кражи.
+	// Погашение и сохранение преемника атомарны, поэтому из двух одновременных запросов успешен один.
+	// Проигравший гонку запрос не отзывает семейство: сессию только что погасил параллельный запрос,
+	// и в grace период он получает ту же пару преемника
+	err = uc.tokenRepository.RotateRefreshSession(ctx, refreshClaim.RefreshID, next, sealed)
+	switch {
+	case errors.Is(err, domain.ErrTokenReused):
+		slog.Warn(op, "сессия погашена параллельным запросом", slog.String("refresh_id", refreshClaim.RefreshID))
+		if consumed, getErr := uc.tokenRepository.GetRefreshSession(ctx, refreshClaim.RefreshID); getErr == nil && consumed != nil {
+			if pair, ok := uc.gracePair(consumed, refreshToken, client); ok {
+				return pair, nil
+			}
+		}
+		return nil, err
+	case errors.Is(err, domain.ErrSessionNotFound):
+		return nil, fmt.Errorf("refresh токен не найден")
+	case err != nil:
+		return nil, fmt.Errorf("внутренняя ошибка при ротации сессии")
+	}
+
+	return tokenPair, nil
+}
+
+// revokeReusedFamily реагирует на повторное использование погашенного refresh токена:
+// токен мог быть украден, поэтому завершается всё семейство сессий и отправляется уведомление
+func (uc *AuthUseCase) revokeReusedFamily(ctx context.Context, session *domain.RefreshSession, client domain.ClientInfo) {
+	const op = "usecase.auth.revokeReusedFamily"
+
+	slog.Warn(op,
+		"повторное использование refresh токена, семейство сессий отозвано",
+		slog.String("userID", session.UserID.String()),
+		slog.String("family_id", session.FamilyID),
+		slog.String("current_ip", client.IP),
+	)
+
+	if _, err := uc.tokenRepository.DeleteSessionFamily(ctx, session.FamilyID); err != nil {
+		slog.Error(op, "не удалось отозвать семейство сессий", slog.String("error", err.Error()))
+	}
+
+	err := uc.emailSender.SendAlert("Предупреждение: Повторное использование refresh токена",
+		fmt.Sprintf("Для пользователя %s предъявлен уже использованный refresh токен (IP: %s, User-Agent: %s). "+
+			"Все сессии устройства, выданные при входе %s, завершены.",
+			session.UserID, client.IP, client.UserAgent, session.CreatedAt.Format(time.RFC3339)))
+	if err != nil {
+		slog.Error(op, "не удалось отправить уведомление", slog.String("error", err.Error()))
+	}
+}
+
+// IntrospectToken проверяет подпись и срок действия токена, а также то, что его сессия не отозвана
+func (uc *AuthUseCase) IntrospectToken(ctx context.Context, token string) (*domain.TokenIntrospection, error) {
+	const op = "usecase.auth.IntrospectToken"
+
+	inactive := &domain.TokenIntrospection{Active: false}
+
+	claims, tokenType, err := uc.parseAnyToken(token)
+	if err != nil {
+		return inactive, nil
+	}
+
+	session, err := uc.tokenRepository.GetRefreshSession(ctx, claims.RefreshID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получении сессии",
+			slog.String("error", err.Error()),
+		)
+		return nil, fmt.Errorf("внутренняя ошибка при интроспекции токена")
+	}
+	if session == nil || session.ConsumedAt != nil || time.Now().After(session.ExpiresAt) {
+		return inactive, nil
+	}
+
+	// Refresh токен дополнительно сверяем с хешем из сессии
+	if tokenType == domain.TokenTypeRefresh {
+		if err = uc.tokenManager.CompareRefreshToken(session.TokenHash, token); err != nil {
+			return inactive, nil
+		}
+	}
+
+	result := &domain.TokenIntrospection{
+		Active:    true,
+		TokenType: tokenType,
+		Subject:   session.UserID.String(),
+		Scope:     strings.Join(session.Scopes, " "),
+		AMR:       session.AMR,
+		ClientID:  session.ClientID,
+		SessionID: session.ID,
+	}
+	if tokenType == domain.TokenTypeAccess {
+		result.Roles = claims.Roles
+	}
+	// Непрозрачный refresh токен не содержит сроков, берём их из сессии
+	result.ExpiresAt, result.IssuedAt = session.ExpiresAt.Unix(), session.LastUsedAt.Unix()
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Unix()
+	}
+	// Refresh токен не содержит auth_time: время входа - это создание первой сессии семейства
+	result.AuthTime = session.CreatedAt.Unix()
+	if claims.AuthTime != nil {
+		result.AuthTime = claims.AuthTime.Unix()
+	}
+
+	return result, nil
+}
+
+// VerifyAccessToken проверяет access токен и то, что его сессия не отозвана.
+// Им защищены собственные маршруты сервиса: после выхода или отзыва устройства
+// токен не должен работать до истечения своего срока
+func (uc *AuthUseCase) VerifyAccessToken(ctx context.Context, token string) (*jwt.TokenClaims, error) {
+	const op = "usecase.auth.VerifyAccessToken"
+
+	claims, err := uc.tokenManager.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := uc.tokenRepository.GetRefreshSession(ctx, claims.RefreshID)
+	if err != nil {
+		slog.Error(op,
+			"ошибка при получении сессии",
+			slog.String("error", err.Error()),
+		)
+		return nil, fmt.Errorf("внутренняя ошибка при проверке сессии")
+	}
+	if session == nil || session.ConsumedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, jwt.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// RevokeToken завершает сессию, к которой относится access или refresh токен.
+// Невалидный, истёкший или уже отозванный токен не считается ошибкой (RFC 7009)
+func (uc *AuthUseCase) RevokeToken(ctx context.Context, token string) error {
+	const op = "usecase.auth.RevokeToken"
+
+	claims, tokenType, err := uc.parseAnyToken(token)
+	if err != nil {
+		slog.Debug(op, "токен не распознан, отзывать нечего", slog.String("error", err.Error()))
+		return nil
+	}
+
+	session, err := uc.tokenRepository.GetRefreshSession(ctx, claims.RefreshID)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при отзыве сессии")
+	}
+	if session == nil {
+		return nil
+	}
+
+	// Непрозрачный refresh токен ничего не подписывает, а ID сессии виден в access токене и в списке
+	// сессий, поэтому без сверки с хешем такой токен мог бы собрать любой, кто знает ID
+	if tokenType == domain.TokenTypeRefresh {
+		if err = uc.tokenManager.CompareRefreshToken(session.TokenHash, token); err != nil {
+			slog.Warn(op, "refresh токен не совпадает с сессией", slog.String("refresh_id", session.ID))
+			return nil
+		}
+	}
+
+	if _, err = uc.tokenRepository.DeleteSessionFamily(ctx, session.FamilyID); err != nil {
+		return fmt.Errorf("внутренняя ошибка при отзыве сессии")
+	}
+
+	slog.Info(op, "сессия отозвана",
+		slog.String("refresh_id", claims.RefreshID),
+		slog.String("family_id", session.FamilyID),
+	)
+	return nil
+}
+
+// ListSessions возвращает действующие сессии (устройства) пользователя
+func (uc *AuthUseCase) ListSessions(ctx context.Context, userID uuid.UUID) ([]domain.RefreshSession, error) {
+	sessions, err := uc.tokenRepository.ListSessionsByUserID(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при получении сессий")
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession завершает одну сессию пользователя. Чужие сессии не видны,
+// поэтому для них, как и для несуществующих, возвращается domain.ErrSessionNotFound
+func (uc *AuthUseCase) RevokeSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	const op = "usecase.auth.RevokeSession"
+
+	deleted, err := uc.tokenRepository.DeleteUserSession(ctx, userID.String(), sessionID)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при завершении сессии")
+	}
+	if !deleted {
+		return domain.ErrSessionNotFound
+	}
+
+	slog.Info(op, "сессия завершена пользователем",
+		slog.String("userID", userID.String()),
+		slog.String("refresh_id", sessionID),
+	)
+	return nil
+}
+
+// RevokeAllSessions завершает все сессии пользователя (выход со всех устройств)
+func (uc *AuthUseCase) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	const op = "usecase.auth.RevokeAllSessions"
+
+	count, err := uc.tokenRepository.DeleteSessionsByUserID(ctx, userID.String())
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при завершении сессий")
+	}
+
+	slog.Info(op, "все сессии пользователя завершены",
+		slog.String("userID", userID.String()),
+		slog.Int64("count", count),
+	)
+	return nil
+}
+
+// parseAnyToken разбирает токен неизвестного типа: сначала как access, затем как refresh
+func (uc *AuthUseCase) parseAnyToken(token string) (*jwt.TokenClaims, string, error) {
+	claims, err := uc.tokenManager.ParseAccessToken(token)
+	if err == nil {
+		return claims, domain.TokenTypeAccess, nil
+	}
+
+	claims, err = uc.tokenManager.ParseRefreshToken(token)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return uc.GenerateTokens(ctx, session.UserID, userIP)
+	return claims, domain.TokenTypeRefresh, nil
 }
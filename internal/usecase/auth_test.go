@@ -0,0 +1,546 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+func TestRefreshTokensRotation(t *testing.T) {
+	env := newAuthTestEnv(t, 0)
+	pair, client := env.login(t)
+
+	next, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+	if next.RefreshToken == pair.RefreshToken || next.AccessToken == pair.AccessToken {
+		t.Fatal("RefreshTokens() вернул прежнюю пару")
+	}
+
+	old := env.repo.session(t, pair.RefreshToken)
+	successor := env.repo.session(t, next.RefreshToken)
+	if old.ConsumedAt == nil {
+		t.Fatal("прежняя сессия должна остаться надгробием")
+	}
+	if successor.FamilyID != old.FamilyID || !successor.CreatedAt.Equal(old.CreatedAt) {
+		t.Fatalf("преемник: семейство %s, вход %s, want %s, %s", successor.FamilyID, successor.CreatedAt, old.FamilyID, old.CreatedAt)
+	}
+	if len(old.SuccessorTokens) != 0 {
+		t.Fatal("без grace периода пара преемника не должна сохраняться")
+	}
+
+	// Свежий токен продолжает цепочку
+	if _, err = env.uc.RefreshTokens(context.Background(), next.RefreshToken, client); err != nil {
+		t.Fatalf("RefreshTokens() преемника error = %v", err)
+	}
+}
+
+func TestRefreshTokensReuse(t *testing.T) {
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		consumedAgo time.Duration // насколько раньше погашена сессия к моменту повторного запроса
+		retryIP     string
+		wantErr     error
+		wantGrace   bool // повторный запрос получает ту же пару преемника
+	}{
+		{
+			name:    "без grace периода",
+			retryIP: "10.0.0.1",
+			wantErr: domain.ErrTokenReused,
+		},
+		{
+			name:        "в grace период с того же IP",
+			gracePeriod: 30 * time.Second,
+			retryIP:     "10.0.0.1",
+			wantGrace:   true,
+		},
+		{
+			name:        "в grace период с другого IP",
+			gracePeriod: 30 * time.Second,
+			retryIP:     "10.0.0.2",
+			wantErr:     domain.ErrTokenReused,
+		},
+		{
+			name:        "после grace периода",
+			gracePeriod: 30 * time.Second,
+			consumedAgo: time.Minute,
+			retryIP:     "10.0.0.1",
+			wantErr:     domain.ErrTokenReused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newAuthTestEnv(t, tt.gracePeriod)
+			pair, client := env.login(t)
+
+			next, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client)
+			if err != nil {
+				t.Fatalf("RefreshTokens() error = %v", err)
+			}
+			env.repo.shiftConsumedAt(t, pair.RefreshToken, -tt.consumedAgo)
+
+			retryClient := domain.ClientInfo{IP: tt.retryIP, UserAgent: client.UserAgent}
+			retried, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, retryClient)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("повторный RefreshTokens() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantGrace {
+				if *retried != *next {
+					t.Fatal("в grace период должна вернуться та же пара преемника")
+				}
+				if env.repo.sessionCount() != 2 || env.alerts.count() != 0 {
+					t.Fatalf("семейство не должно отзываться: сессий %d, уведомлений %d", env.repo.sessionCount(), env.alerts.count())
+				}
+				return
+			}
+
+			// Повторное предъявление - признак кражи: семейство отозвано вместе с преемником
+			if env.repo.sessionCount() != 0 {
+				t.Fatalf("после повторного использования осталось сессий: %d", env.repo.sessionCount())
+			}
+			if env.alerts.count() != 1 {
+				t.Fatalf("отправлено уведомлений: %d, want 1", env.alerts.count())
+			}
+			if _, err = env.uc.RefreshTokens(context.Background(), next.RefreshToken, client); err == nil {
+				t.Fatal("токен преемника должен перестать работать после отзыва семейства")
+			}
+		})
+	}
+}
+
+func TestRefreshTokensLostRace(t *testing.T) {
+	env := newAuthTestEnv(t, 0)
+	pair, client := env.login(t)
+
+	// Параллельный запрос с тем же токеном успевает погасить сессию раньше
+	env.repo.beforeRotate = func() {
+		if _, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client); err != nil {
+			t.Errorf("параллельный RefreshTokens() error = %v", err)
+		}
+	}
+
+	// Без grace периода пары преемника нет: проигравший получает отказ, но семейство не отзывает
+	if _, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client); !errors.Is(err, domain.ErrTokenReused) {
+		t.Fatalf("RefreshTokens() error = %v, want %v", err, domain.ErrTokenReused)
+	}
+	if env.repo.sessionCount() != 2 || env.alerts.count() != 0 {
+		t.Fatalf("проигравший гонку запрос не должен отзывать семейство: сессий %d, уведомлений %d",
+			env.repo.sessionCount(), env.alerts.count())
+	}
+}
+
+func TestRefreshTokensLostRaceGetsSuccessor(t *testing.T) {
+	env := newAuthTestEnv(t, 30*time.Second)
+	pair, client := env.login(t)
+
+	// Параллельный запрос с тем же токеном успевает погасить сессию раньше
+	var winner *jwt.TokenPair
+	env.repo.beforeRotate = func() {
+		var err error
+		if winner, err = env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client); err != nil {
+			t.Errorf("параллельный RefreshTokens() error = %v", err)
+		}
+	}
+
+	loser, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+	if winner == nil || *loser != *winner {
+		t.Fatal("проигравший гонку запрос должен получить пару победителя")
+	}
+	if env.repo.sessionCount() != 2 || env.alerts.count() != 0 {
+		t.Fatalf("семейство не должно отзываться: сессий %d, уведомлений %d", env.repo.sessionCount(), env.alerts.count())
+	}
+}
+
+func TestRefreshTokensRejected(t *testing.T) {
+	tests := []struct {
+		name          string
+		prepare       func(t *testing.T, env *authTestEnv, pair *jwt.TokenPair) string
+		clientID      string
+		wantRevoked   bool // семейство сессий удалено
+		wantSessionOK bool // сессия осталась рабочей
+	}{
+		{
+			name: "токен не совпадает с хешем сессии",
+			prepare: func(t *testing.T, env *authTestEnv, pair *jwt.TokenPair) string {
+				env.repo.setTokenHash(t, pair.RefreshToken, "v2$00")
+				return pair.RefreshToken
+			},
+		},
+		{
+			name: "сессия OAuth клиента",
+			prepare: func(t *testing.T, env *authTestEnv, pair *jwt.TokenPair) string {
+				return pair.RefreshToken
+			},
+			clientID:      "client",
+			wantSessionOK: true,
+		},
+		{
+			name: "истёкшая сессия",
+			prepare: func(t *testing.T, env *authTestEnv, pair *jwt.TokenPair) string {
+				env.repo.expire(t, pair.RefreshToken)
+				return pair.RefreshToken
+			},
+			wantRevoked: true,
+		},
+		{
+			name: "access токен вместо refresh",
+			prepare: func(t *testing.T, env *authTestEnv, pair *jwt.TokenPair) string {
+				return pair.AccessToken
+			},
+			wantSessionOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newAuthTestEnv(t, 30*time.Second)
+			pair, client := env.login(t)
+			token := tt.prepare(t, env, pair)
+
+			client.ClientID = tt.clientID
+			if _, err := env.uc.RefreshTokens(context.Background(), token, client); err == nil {
+				t.Fatal("RefreshTokens() должен вернуть ошибку")
+			}
+
+			if revoked := env.repo.sessionCount() == 0; revoked != tt.wantRevoked {
+				t.Fatalf("семейство отозвано = %v, want %v", revoked, tt.wantRevoked)
+			}
+			if env.alerts.count() != 0 {
+				t.Fatal("отказ без повторного использования не должен отправлять уведомление")
+			}
+			if tt.wantSessionOK {
+				client.ClientID = ""
+				if _, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client); err != nil {
+					t.Fatalf("сессия должна остаться рабочей: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	env := newAuthTestEnv(t, 0)
+	env.uc.claimsProvider = fakeClaimsProvider{claims: &domain.UserClaims{AllowedScopes: []string{"profile", "orders:read"}}}
+	client := domain.ClientInfo{IP: "10.0.0.1", UserAgent: "test"}
+
+	if _, err := env.uc.GenerateTokens(context.Background(), uuid.New(), []string{"admin"}, nil, client); !errors.Is(err, domain.ErrScopeNotAllowed) {
+		t.Fatalf("GenerateTokens(admin) error = %v, want %v", err, domain.ErrScopeNotAllowed)
+	}
+
+	pair, err := env.uc.GenerateTokens(context.Background(), uuid.New(), []string{"orders:read"}, nil, client)
+	if err != nil {
+		t.Fatalf("GenerateTokens() error = %v", err)
+	}
+	claims, err := env.uc.tokenManager.ParseAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if !claims.HasScope("orders:read") || claims.HasScope("profile") {
+		t.Fatalf("scope = %q, want только запрошенный orders:read", claims.Scope)
+	}
+
+	// Права пользователя сократились: при обновлении отозванный scope не выдаётся
+	env.uc.claimsProvider = fakeClaimsProvider{claims: &domain.UserClaims{AllowedScopes: []string{"profile"}}}
+	next, err := env.uc.RefreshTokens(context.Background(), pair.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+	if claims, err = env.uc.tokenManager.ParseAccessToken(next.AccessToken); err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if claims.HasScope("orders:read") {
+		t.Fatalf("scope = %q, отозванный scope не должен выдаваться", claims.Scope)
+	}
+}
+
+func TestGenerateTokensRequiresMFA(t *testing.T) {
+	env := newAuthTestEnv(t, 0)
+	env.uc.mfaRepository = &fakeMFAStatusRepo{enabled: true}
+	client := domain.ClientInfo{IP: "10.0.0.1", UserAgent: "test"}
+	userID := uuid.New()
+
+	_, err := env.uc.GenerateTokens(context.Background(), userID, nil, []string{jwt.AMRPassword}, client)
+	var challenge *domain.MFAChallenge
+	if !errors.As(err, &challenge) {
+		t.Fatalf("GenerateTokens() error = %v, want *domain.MFAChallenge", err)
+	}
+	if env.repo.sessionCount() != 0 {
+		t.Fatal("до проверки второго фактора сессия не должна открываться")
+	}
+
+	claims, err := jwt.NewTokenManager(jwt.NewKeyring(jwt.NewHMACKey("secret")), jwt.Options{}).ParseMFAToken(challenge.Token)
+	if err != nil {
+		t.Fatalf("ParseMFAToken() error = %v", err)
+	}
+	if claims.UserID != userID || !claims.HasAMR(jwt.AMRPassword) {
+		t.Fatalf("ParseMFAToken() claims = %+v", claims)
+	}
+
+	// После проверки второго фактора сессия открывается
+	amr := []string{jwt.AMRPassword, jwt.AMROTP, jwt.AMRMultiFactor}
+	if _, err = env.uc.GenerateTokens(context.Background(), userID, nil, amr, client); err != nil {
+		t.Fatalf("GenerateTokens() после второго фактора error = %v", err)
+	}
+}
+
+func TestRevokeTokenChecksRefreshHash(t *testing.T) {
+	env := newAuthTestEnv(t, 0)
+	pair, _ := env.login(t)
+
+	// Токен с ID сессии, но не совпадающий с её хешем, сессию не отзывает
+	env.repo.setTokenHash(t, pair.RefreshToken, "v2$00")
+	if err := env.uc.RevokeToken(context.Background(), pair.RefreshToken); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if env.repo.sessionCount() != 1 {
+		t.Fatal("несовпадающий refresh токен не должен отзывать сессию")
+	}
+
+	// Access токен подписан сервисом и отзывает свою сессию без сверки хеша
+	if err := env.uc.RevokeToken(context.Background(), pair.AccessToken); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if env.repo.sessionCount() != 0 {
+		t.Fatal("сессия access токена должна быть отозвана")
+	}
+}
+
+func TestVerifyAccessTokenChecksSession(t *testing.T) {
+	env := newAuthTestEnv(t, 0)
+	pair, _ := env.login(t)
+
+	claims, err := env.uc.VerifyAccessToken(context.Background(), pair.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken() error = %v", err)
+	}
+
+	introspection, err := env.uc.IntrospectToken(context.Background(), pair.AccessToken)
+	if err != nil {
+		t.Fatalf("IntrospectToken() error = %v", err)
+	}
+	if claims.AuthTime == nil || introspection.AuthTime != claims.AuthTime.Unix() {
+		t.Fatalf("IntrospectToken() auth_time = %d, want %v", introspection.AuthTime, claims.AuthTime)
+	}
+
+	// Подпись отозванного токена по-прежнему верна, но его сессии больше нет
+	if err = env.uc.RevokeToken(context.Background(), pair.AccessToken); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if _, err = env.uc.VerifyAccessToken(context.Background(), pair.AccessToken); !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Fatalf("VerifyAccessToken() после отзыва error = %v, want %v", err, jwt.ErrInvalidToken)
+	}
+}
+
+type authTestEnv struct {
+	uc     *AuthUseCase
+	repo   *fakeSessionRepo
+	alerts *fakeAlertSender
+}
+
+func newAuthTestEnv(t *testing.T, gracePeriod time.Duration) *authTestEnv {
+	t.Helper()
+
+	tm := jwt.NewTokenManager(jwt.NewKeyring(jwt.NewHMACKey("secret")), jwt.Options{
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+		Pepper:     "pepper",
+	})
+	repo := &fakeSessionRepo{sessions: map[string]*domain.RefreshSession{}}
+	alerts := &fakeAlertSender{}
+
+	return &authTestEnv{
+		uc: &AuthUseCase{
+			tokenManager:    tm,
+			tokenRepository: repo,
+			emailSender:     alerts,
+			claimsProvider:  fakeClaimsProvider{claims: &domain.UserClaims{AllowedScopes: []string{"profile"}}},
+			mfaRepository:   &fakeMFAStatusRepo{},
+			mfaChallengeTTL: time.Minute,
+			gracePeriod:     gracePeriod,
+		},
+		repo:   repo,
+		alerts: alerts,
+	}
+}
+
+// login открывает сессию так же, как вход по паролю
+func (env *authTestEnv) login(t *testing.T) (*jwt.TokenPair, domain.ClientInfo) {
+	t.Helper()
+
+	client := domain.ClientInfo{IP: "10.0.0.1", UserAgent: "test"}
+	pair, err := env.uc.GenerateTokens(context.Background(), uuid.New(), nil, []string{jwt.AMRPassword}, client)
+	if err != nil {
+		t.Fatalf("GenerateTokens() error = %v", err)
+	}
+
+	return pair, client
+}
+
+// fakeSessionRepo хранит сессии в памяти и повторяет атомарность RotateRefreshSession
+type fakeSessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]*domain.RefreshSession
+
+	// beforeRotate вызывается один раз перед погашением сессии, имитируя параллельный запрос
+	beforeRotate func()
+}
+
+func (r *fakeSessionRepo) SaveRefreshSession(_ context.Context, session *domain.RefreshSession, _ int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil, nil
+}
+
+func (r *fakeSessionRepo) GetRefreshSession(_ context.Context, refreshID string) (*domain.RefreshSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[refreshID]
+	if !ok {
+		return nil, nil
+	}
+	found := *session
+	return &found, nil
+}
+
+func (r *fakeSessionRepo) RotateRefreshSession(_ context.Context, refreshID string, next *domain.RefreshSession, successorTokens []byte) error {
+	if hook := r.beforeRotate; hook != nil {
+		r.beforeRotate = nil
+		hook()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[refreshID]
+	if !ok {
+		return domain.ErrSessionNotFound
+	}
+	if session.ConsumedAt != nil {
+		return domain.ErrTokenReused
+	}
+
+	now := time.Now()
+	session.ConsumedAt, session.SuccessorTokens = &now, successorTokens
+	stored := *next
+	r.sessions[next.ID] = &stored
+	return nil
+}
+
+func (r *fakeSessionRepo) DeleteSessionFamily(_ context.Context, familyID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	for id, session := range r.sessions {
+		if session.FamilyID == familyID {
+			delete(r.sessions, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeSessionRepo) ListSessionsByUserID(context.Context, string) ([]domain.RefreshSession, error) {
+	return nil, nil
+}
+
+func (r *fakeSessionRepo) DeleteUserSession(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (r *fakeSessionRepo) DeleteSessionsByUserID(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+func (r *fakeSessionRepo) sessionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.sessions)
+}
+
+// session возвращает сохранённую сессию refresh токена
+func (r *fakeSessionRepo) session(t *testing.T, refreshToken string) *domain.RefreshSession {
+	t.Helper()
+
+	claims, err := jwt.NewTokenManager(jwt.NewKeyring(jwt.NewHMACKey("secret")), jwt.Options{}).ParseRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken() error = %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[claims.RefreshID]
+	if !ok {
+		t.Fatalf("сессия %s не найдена", claims.RefreshID)
+	}
+	return session
+}
+
+func (r *fakeSessionRepo) shiftConsumedAt(t *testing.T, refreshToken string, shift time.Duration) {
+	session := r.session(t, refreshToken)
+	consumedAt := session.ConsumedAt.Add(shift)
+	session.ConsumedAt = &consumedAt
+}
+
+func (r *fakeSessionRepo) setTokenHash(t *testing.T, refreshToken, hash string) {
+	r.session(t, refreshToken).TokenHash = hash
+}
+
+func (r *fakeSessionRepo) expire(t *testing.T, refreshToken string) {
+	r.session(t, refreshToken).ExpiresAt = time.Now().Add(-time.Second)
+}
+
+type fakeClaimsProvider struct {
+	claims *domain.UserClaims
+}
+
+func (p fakeClaimsProvider) UserClaims(context.Context, uuid.UUID) (*domain.UserClaims, error) {
+	return p.claims, nil
+}
+
+type fakeMFAStatusRepo struct {
+	enabled bool
+}
+
+func (r *fakeMFAStatusRepo) IsMFAEnabled(context.Context, string) (bool, error) {
+	return r.enabled, nil
+}
+
+type fakeAlertSender struct {
+	mu   sync.Mutex
+	sent int
+}
+
+func (s *fakeAlertSender) SendAlert(string, string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent++
+	return nil
+}
+
+func (s *fakeAlertSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sent
+}
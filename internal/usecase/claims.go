@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/internal/domain"
+)
+
+// ClaimsProvider обогащает access токен данными авторизации пользователя
+type ClaimsProvider interface {
+	UserClaims(ctx context.Context, userID uuid.UUID) (*domain.UserClaims, error)
+}
+
+type UserRoleRepo interface {
+	GetUserRoles(ctx context.Context, userID string) ([]string, error)
+}
+
+// RoleClaimsProvider выдаёт роли пользователя из БД и scopes, разрешённые ролям в конфигурации
+type RoleClaimsProvider struct {
+	roleRepository UserRoleRepo
+	scopes         config.ScopeConfig
+}
+
+func NewRoleClaimsProvider(roleRepo UserRoleRepo, scopes config.ScopeConfig) *RoleClaimsProvider {
+	return &RoleClaimsProvider{
+		roleRepository: roleRepo,
+		scopes:         scopes,
+	}
+}
+
+func (p *RoleClaimsProvider) UserClaims(ctx context.Context, userID uuid.UUID) (*domain.UserClaims, error) {
+	roles, err := p.roleRepository.GetUserRoles(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить роли пользователя: %w", err)
+	}
+
+	allowed := slices.Clone(p.scopes.Default)
+	for _, role := range roles {
+		for _, scope := range p.scopes.ByRole[role] {
+			if !slices.Contains(allowed, scope) {
+				allowed = append(allowed, scope)
+			}
+		}
+	}
+
+	return &domain.UserClaims{
+		Roles:         roles,
+		AllowedScopes: allowed,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// successorTokens - пара токенов преемника, сохраняемая в надгробии на время grace периода
+type successorTokens struct {
+	Pair jwt.TokenPair `json:"pair"`
+	IP   string        `json:"ip"` // IP клиента, выполнившего ротацию
+}
+
+// sealSuccessor шифрует пару преемника ключом, производным от погашаемого refresh токена.
+// Расшифровать её может только тот, кто предъявит этот же токен, утечка БД пару не раскрывает
+func sealSuccessor(refreshToken string, pair *jwt.TokenPair, ip string) ([]byte, error) {
+	plaintext, err := json.Marshal(successorTokens{Pair: *pair, IP: ip})
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := successorCipher(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openSuccessor(refreshToken string, sealed []byte) (*successorTokens, error) {
+	aead, err := successorCipher(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("повреждённая пара преемника")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var successor successorTokens
+	if err = json.Unmarshal(plaintext, &successor); err != nil {
+		return nil, err
+	}
+
+	return &successor, nil
+}
+
+func successorCipher(refreshToken string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("refresh-grace:" + refreshToken))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// gracePair возвращает уже выданную пару преемника, если погашенный токен предъявлен
+// в течение grace периода с того же IP, что и выполнивший ротацию запрос
+func (uc *AuthUseCase) gracePair(session *domain.RefreshSession, refreshToken string, client domain.ClientInfo) (*jwt.TokenPair, bool) {
+	if uc.gracePeriod <= 0 || session.ConsumedAt == nil || len(session.SuccessorTokens) == 0 {
+		return nil, false
+	}
+	if time.Since(*session.ConsumedAt) > uc.gracePeriod {
+		return nil, false
+	}
+
+	successor, err := openSuccessor(refreshToken, session.SuccessorTokens)
+	if err != nil || successor.IP != client.IP {
+		return nil, false
+	}
+
+	return &successor.Pair, true
+}
@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// RequestMagicLink отправляет письмо со ссылкой и 6-значным кодом для входа без пароля и возвращает
+// nonce устройства со сроком его действия. Ссылка и код принимаются только вместе с этим nonce,
+// поэтому войти можно лишь на устройстве, запросившем вход. nonce - значение cookie устройства
+// из прежнего запроса: если оно есть, письмо привязывается к нему, и ссылки из прежних писем
+// на устройстве продолжают работать. Письмо отправляется в фоне, поэтому для незарегистрированного
+// email, при превышении частоты писем и при ошибке отправки ответ одинаков
+func (uc *UserUseCase) RequestMagicLink(ctx context.Context, email, nonce string) (string, time.Time, error) {
+	const op = "usecase.user.RequestMagicLink"
+
+	if !validMagicLinkNonce(nonce) {
+		var err error
+		if nonce, _, err = newOneTimeToken(); err != nil {
+			slog.Error(op, "ошибка при генерации nonce", slog.String("error", err.Error()))
+			return "", time.Time{}, fmt.Errorf("внутренняя ошибка при отправке ссылки для входа")
+		}
+	}
+	expiresAt := time.Now().Add(uc.verification.MagicLinkTTL)
+
+	uc.inBackground(ctx, func(ctx context.Context) {
+		_ = uc.sendMagicLink(ctx, email, nonce, expiresAt)
+	})
+
+	return nonce, expiresAt, nil
+}
+
+// sendMagicLink выпускает токен входа, привязанный к nonce устройства, и отправляет письмо с ним
+func (uc *UserUseCase) sendMagicLink(ctx context.Context, email, nonce string, expiresAt time.Time) error {
+	const op = "usecase.user.sendMagicLink"
+
+	user, err := uc.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		slog.Debug("вход по ссылке для незарегистрированного email", slog.String("op", op))
+		return nil
+	}
+
+	limited, err := uc.emailRateLimited(ctx, user.ID.String(), domain.TokenPurposeMagicLink)
+	if err != nil {
+		slog.Error(op, "ошибка при проверке частоты писем",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if limited {
+		slog.Warn(op, "превышена частота писем для входа", slog.String("user_id", user.ID.String()))
+		return nil
+	}
+
+	token, tokenHash, err := newOneTimeToken()
+	if err != nil {
+		slog.Error(op, "ошибка при генерации токена", slog.String("error", err.Error()))
+		return err
+	}
+	code, err := newMagicLinkCode()
+	if err != nil {
+		slog.Error(op, "ошибка при генерации кода", slog.String("error", err.Error()))
+		return err
+	}
+
+	err = uc.oneTimeTokenRepository.SaveOneTimeToken(ctx, &domain.OneTimeToken{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		Purpose:   domain.TokenPurposeMagicLink,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+		NonceHash: hashOneTimeToken(nonce),
+		CodeHash:  hashMagicLinkCode(nonce, code),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := uc.verification.MagicLinkURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Для входа перейдите по ссылке:\n\n%s\n\nили введите код: %s\n\nСсылка и код действуют до %s, "+
+		"один раз и только в браузере или приложении, где был запрошен вход. "+
+		"Если вы не запрашивали вход, просто проигнорируйте это письмо.",
+		link, code, expiresAt.Format("02.01.2006 15:04 MST"))
+
+	if err = uc.emailSender.SendEmail(user.Email, "Вход в аккаунт", body); err != nil {
+		slog.Error(op, "ошибка при отправке письма",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyMagicLink открывает сессию по токену из ссылки или коду из письма. nonce - значение
+// cookie устройства, запросившего вход: без него ни ссылка, ни код не принимаются.
+// Вход по письму подтверждает email. Если у пользователя включён второй фактор,
+// вместо пары токенов возвращается *domain.MFAChallenge
+func (uc *UserUseCase) VerifyMagicLink(ctx context.Context, nonce, token, code string, scopes []string, client domain.ClientInfo) (*jwt.TokenPair, error) {
+	const op = "usecase.user.VerifyMagicLink"
+
+	if nonce == "" {
+		return nil, domain.ErrInvalidOneTimeToken
+	}
+
+	var userID string
+	var err error
+	if token != "" {
+		userID, err = uc.oneTimeTokenRepository.ConsumeBoundOneTimeToken(ctx, hashOneTimeToken(token), hashOneTimeToken(nonce), domain.TokenPurposeMagicLink)
+	} else {
+		userID, err = uc.oneTimeTokenRepository.ConsumeOneTimeCode(ctx, hashOneTimeToken(nonce), hashMagicLinkCode(nonce, code),
+			domain.TokenPurposeMagicLink, uc.verification.MagicLinkAttempts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при входе")
+	}
+	if userID == "" {
+		slog.Warn(op, "недействительная ссылка или код для входа", slog.String("ip", client.IP))
+		return nil, domain.ErrInvalidOneTimeToken
+	}
+
+	parsedID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при входе")
+	}
+
+	// Остальные ссылки для входа больше не нужны, а само письмо подтверждает владение адресом
+	_ = uc.oneTimeTokenRepository.DeleteOneTimeTokens(ctx, userID, domain.TokenPurposeMagicLink)
+	// Вход не зависит от отметки о подтверждении: при ошибке пользователь подтвердит адрес следующим входом по письму
+	if err = uc.userRepository.MarkEmailVerified(ctx, userID); err != nil {
+		slog.Error(op, "ошибка при подтверждении email",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	slog.Info(op, "ссылка или код для входа приняты", slog.String("user_id", userID))
+	return uc.tokenIssuer.GenerateTokens(ctx, parsedID, scopes, []string{jwt.AMREmail}, client)
+}
+
+// validMagicLinkNonce сообщает, что nonce из cookie выпущен сервисом: 256 бит в base64url, как newOneTimeToken
+func validMagicLinkNonce(nonce string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	return err == nil && len(raw) == 32
+}
+
+// newMagicLinkCode генерирует 6-значный код для ввода вручную
+func newMagicLinkCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashMagicLinkCode хеширует код вместе с nonce устройства: короткий код нельзя
+// подобрать по хешу из БД, не зная nonce, который хранится только в cookie
+func hashMagicLinkCode(nonce, code string) string {
+	return hashOneTimeToken(nonce + ":" + code)
+}
@@ -0,0 +1,370 @@
+package usecase
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/pkg/jwt"
+	"github.com/medods/auth-service/pkg/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+	totpSkew          = 1   // допуск в шагах TOTP на расхождение часов
+	qrCodeSize        = 256 // сторона QR кода в пикселях
+)
+
+type MFARepo interface {
+	GetUserMFA(ctx context.Context, userID string) (*domain.UserMFA, error)
+	SavePendingMFA(ctx context.Context, mfa *domain.UserMFA) error
+	EnableMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error
+	DeleteMFA(ctx context.Context, userID string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	RecordMFAFailure(ctx context.Context, userID string, window time.Duration) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	RedeemMFAChallenge(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+}
+
+type UserLookup interface {
+	GetUserByID(ctx context.Context, userID string) (*domain.User, error)
+}
+
+type MFATokenParser interface {
+	ParseMFAToken(mfaToken string) (*jwt.TokenClaims, error)
+}
+
+type MFAUseCase struct {
+	mfaRepository  MFARepo
+	userRepository UserLookup
+	tokenParser    MFATokenParser
+	tokenIssuer    TokenIssuer
+	config         config.MFAConfig
+}
+
+func NewMFAUseCase(
+	mfaRepo MFARepo,
+	userRepo UserLookup,
+	tokenParser MFATokenParser,
+	tokenIssuer TokenIssuer,
+	mfaCfg config.MFAConfig,
+) *MFAUseCase {
+	return &MFAUseCase{
+		mfaRepository:  mfaRepo,
+		userRepository: userRepo,
+		tokenParser:    tokenParser,
+		tokenIssuer:    tokenIssuer,
+		config:         mfaCfg,
+	}
+}
+
+// EnrollTOTP создаёт новый секрет TOTP. Второй фактор включается только после
+// подтверждения кодом из приложения (ConfirmTOTP), до этого вход не меняется
+func (uc *MFAUseCase) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPEnrollment, error) {
+	const op = "usecase.mfa.EnrollTOTP"
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		slog.Error(op, "ошибка при генерации секрета", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+
+	sealed, err := uc.sealSecret(userID, secret)
+	if err != nil {
+		slog.Error(op, "ошибка при шифровании секрета", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+
+	err = uc.mfaRepository.SavePendingMFA(ctx, &domain.UserMFA{UserID: userID, Secret: sealed, CreatedAt: time.Now()})
+	if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+
+	// В приложении запись подписывается email, а для пользователей без учётной записи - их ID
+	account := userID.String()
+	if user, err := uc.userRepository.GetUserByID(ctx, userID.String()); err == nil && user != nil {
+		account = user.Email
+	}
+
+	uri := totp.URI(uc.config.Issuer, account, secret)
+	qrCode, err := totp.QRCodePNG(uri, qrCodeSize)
+	if err != nil {
+		slog.Error(op, "ошибка при построении QR кода", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+
+	return &domain.TOTPEnrollment{Secret: secret, URI: uri, QRCodePNG: qrCode}, nil
+}
+
+// ConfirmTOTP включает второй фактор по первому коду из приложения и возвращает
+// коды восстановления. Коды показываются один раз, в БД хранятся только их хеши
+func (uc *MFAUseCase) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	const op = "usecase.mfa.ConfirmTOTP"
+
+	mfa, err := uc.mfaRepository.GetUserMFA(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+	if mfa == nil {
+		return nil, domain.ErrMFANotEnabled
+	}
+	if mfa.Enabled {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+	if uc.lockedOut(mfa) {
+		return nil, domain.ErrTooManyRequests
+	}
+
+	step, ok := uc.validateTOTP(mfa, code)
+	if !ok {
+		uc.recordFailure(ctx, userID)
+		return nil, domain.ErrInvalidMFACode
+	}
+
+	codes, hashes, err := uc.newRecoveryCodes(userID)
+	if err != nil {
+		slog.Error(op, "ошибка при генерации кодов восстановления", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+
+	err = uc.mfaRepository.EnableMFA(ctx, userID.String(), step, hashes)
+	if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при настройке второго фактора")
+	}
+
+	slog.Info(op, "второй фактор включён", slog.String("userID", userID.String()))
+	return codes, nil
+}
+
+// DisableTOTP отключает второй фактор. Требуется действующий код или код восстановления
+func (uc *MFAUseCase) DisableTOTP(ctx context.Context, userID uuid.UUID, code, recoveryCode string) error {
+	const op = "usecase.mfa.DisableTOTP"
+
+	if err := uc.verifyEnabled(ctx, userID, code, recoveryCode); err != nil {
+		return err
+	}
+
+	if err := uc.mfaRepository.DeleteMFA(ctx, userID.String()); err != nil {
+		return fmt.Errorf("внутренняя ошибка при отключении второго фактора")
+	}
+
+	slog.Info(op, "второй фактор отключён", slog.String("userID", userID.String()))
+	return nil
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми, прежние перестают действовать
+func (uc *MFAUseCase) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	const op = "usecase.mfa.RegenerateRecoveryCodes"
+
+	if err := uc.verifyEnabled(ctx, userID, code, ""); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := uc.newRecoveryCodes(userID)
+	if err != nil {
+		slog.Error(op, "ошибка при генерации кодов восстановления", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при замене кодов восстановления")
+	}
+
+	if err = uc.mfaRepository.ReplaceRecoveryCodes(ctx, userID.String(), hashes); err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при замене кодов восстановления")
+	}
+
+	return codes, nil
+}
+
+// VerifyMFA завершает вход: проверяет второй фактор для токена MFA challenge и открывает
+// сессию с запрошенными при входе scopes. В amr сессии добавляются otp и mfa
+func (uc *MFAUseCase) VerifyMFA(ctx context.Context, mfaToken, code, recoveryCode string, client domain.ClientInfo) (*jwt.TokenPair, error) {
+	const op = "usecase.mfa.VerifyMFA"
+
+	claims, err := uc.tokenParser.ParseMFAToken(mfaToken)
+	if err != nil {
+		slog.Debug(op, "невалидный токен MFA challenge", slog.String("error", err.Error()))
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	err = uc.verifyEnabled(ctx, claims.UserID, code, recoveryCode)
+	if errors.Is(err, domain.ErrMFANotEnabled) {
+		// Второй фактор отключили после выдачи challenge - пусть войдёт заново
+		return nil, domain.ErrInvalidMFAToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Challenge одноразовый: гасится только после верного кода, чтобы опечатка не заставляла входить заново
+	if claims.ExpiresAt == nil {
+		return nil, domain.ErrInvalidMFAToken
+	}
+	redeemed, err := uc.mfaRepository.RedeemMFAChallenge(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+	}
+	if !redeemed {
+		slog.Warn(op, "повторное использование токена MFA challenge", slog.String("userID", claims.UserID.String()))
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	amr := append(claims.AMR, jwt.AMROTP, jwt.AMRMultiFactor)
+	return uc.tokenIssuer.GenerateTokens(ctx, claims.UserID, claims.Scopes(), amr, client)
+}
+
+// verifyEnabled проверяет код TOTP или код восстановления для включённого второго фактора.
+// После MaxAttempts неверных кодов проверка блокируется на Lockout
+func (uc *MFAUseCase) verifyEnabled(ctx context.Context, userID uuid.UUID, code, recoveryCode string) error {
+	const op = "usecase.mfa.verifyEnabled"
+
+	mfa, err := uc.mfaRepository.GetUserMFA(ctx, userID.String())
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+	}
+	if mfa == nil || !mfa.Enabled {
+		return domain.ErrMFANotEnabled
+	}
+	if uc.lockedOut(mfa) {
+		slog.Warn(op, "проверка второго фактора заблокирована", slog.String("userID", userID.String()))
+		return domain.ErrTooManyRequests
+	}
+
+	var accepted bool
+	if recoveryCode != "" {
+		accepted, err = uc.mfaRepository.UseRecoveryCode(ctx, userID.String(), uc.hashRecoveryCode(userID, recoveryCode))
+		if accepted {
+			slog.Info(op, "использован код восстановления", slog.String("userID", userID.String()))
+		}
+	} else if step, ok := uc.validateTOTP(mfa, code); ok {
+		// Код уже принятого шага не принимается повторно, даже если ещё не истёк
+		accepted, err = uc.mfaRepository.UseTOTPStep(ctx, userID.String(), step)
+	}
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+	}
+
+	if !accepted {
+		slog.Warn(op, "неверный код второго фактора", slog.String("userID", userID.String()))
+		uc.recordFailure(ctx, userID)
+		return domain.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func (uc *MFAUseCase) validateTOTP(mfa *domain.UserMFA, code string) (int64, bool) {
+	const op = "usecase.mfa.validateTOTP"
+
+	secret, err := uc.openSecret(mfa.UserID, mfa.Secret)
+	if err != nil {
+		slog.Error(op, "не удалось расшифровать секрет",
+			slog.String("userID", mfa.UserID.String()),
+			slog.String("error", err.Error()),
+		)
+		return 0, false
+	}
+
+	return totp.Validate(secret, code, time.Now(), totpSkew)
+}
+
+func (uc *MFAUseCase) lockedOut(mfa *domain.UserMFA) bool {
+	return mfa.FailedAttempts >= uc.config.MaxAttempts &&
+		mfa.LastFailedAt != nil && time.Since(*mfa.LastFailedAt) < uc.config.Lockout
+}
+
+func (uc *MFAUseCase) recordFailure(ctx context.Context, userID uuid.UUID) {
+	_ = uc.mfaRepository.RecordMFAFailure(ctx, userID.String(), uc.config.Lockout)
+}
+
+// newRecoveryCodes генерирует коды восстановления вида xxxx-xxxx (40 случайных бит)
+func (uc *MFAUseCase) newRecoveryCodes(userID uuid.UUID) (codes, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err = rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(raw))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, uc.hashRecoveryCode(userID, code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode - HMAC кода ключом сервиса: короткие коды нельзя подобрать по утёкшей таблице
+func (uc *MFAUseCase) hashRecoveryCode(userID uuid.UUID, code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	mac := hmac.New(sha256.New, []byte("mfa-recovery:"+uc.config.EncryptionKey))
+	mac.Write([]byte(userID.String() + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sealSecret шифрует секрет TOTP ключом сервиса. ID пользователя входит в
+// аутентифицируемые данные, поэтому секрет нельзя перенести другому пользователю
+func (uc *MFAUseCase) sealSecret(userID uuid.UUID, secret string) ([]byte, error) {
+	aead, err := uc.secretCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, []byte(secret), userID[:]), nil
+}
+
+func (uc *MFAUseCase) openSecret(userID uuid.UUID, sealed []byte) (string, error) {
+	aead, err := uc.secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("повреждённый секрет TOTP")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	secret, err := aead.Open(nil, nonce, ciphertext, userID[:])
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func (uc *MFAUseCase) secretCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("totp-secret:" + uc.config.EncryptionKey))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
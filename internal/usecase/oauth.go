@@ -0,0 +1,428 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type OAuthRepo interface {
+	CreateOAuthClient(ctx context.Context, client *domain.OAuthClient) error
+	GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]domain.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientID string) (bool, error)
+	SaveAuthorizationCode(ctx context.Context, code *domain.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error)
+	BindAuthorizationCodeFamily(ctx context.Context, codeHash, familyID string) (bool, error)
+}
+
+// OAuthTokenIssuer открывает и обновляет сессии OAuth клиентов, реализуется AuthUseCase
+type OAuthTokenIssuer interface {
+	GenerateTokens(ctx context.Context, userID uuid.UUID, scopes, amr []string, client domain.ClientInfo) (*jwt.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (*jwt.TokenPair, error)
+}
+
+type AccessTokenParser interface {
+	ParseAccessToken(accessToken string) (*jwt.TokenClaims, error)
+}
+
+type OAuthUseCase struct {
+	oauthRepository OAuthRepo
+	mfaRepository   MFAStatusRepo
+	claimsProvider  ClaimsProvider
+	tokenIssuer     OAuthTokenIssuer
+	tokenParser     AccessTokenParser
+	codeTTL         time.Duration
+}
+
+func NewOAuthUseCase(
+	oauthRepo OAuthRepo,
+	mfaRepo MFAStatusRepo,
+	claimsProvider ClaimsProvider,
+	tokenIssuer OAuthTokenIssuer,
+	tokenParser AccessTokenParser,
+	oauthCfg config.OAuthConfig,
+) *OAuthUseCase {
+	return &OAuthUseCase{
+		oauthRepository: oauthRepo,
+		mfaRepository:   mfaRepo,
+		claimsProvider:  claimsProvider,
+		tokenIssuer:     tokenIssuer,
+		tokenParser:     tokenParser,
+		codeTTL:         oauthCfg.CodeTTL,
+	}
+}
+
+// RegisterClient регистрирует стороннее приложение и возвращает его вместе с секретом.
+// Секрет показывается один раз, в БД хранится его хеш. Публичному клиенту секрет не выдаётся
+func (uc *OAuthUseCase) RegisterClient(ctx context.Context, name string, redirectURIs, scopes []string, public bool) (*domain.OAuthClient, string, error) {
+	const op = "usecase.oauth.RegisterClient"
+
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", domain.ErrInvalidRedirectURI
+		}
+	}
+
+	client := &domain.OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if !public {
+		var err error
+		if secret, client.SecretHash, err = newOneTimeToken(); err != nil {
+			slog.Error(op, "ошибка при генерации секрета клиента", slog.String("error", err.Error()))
+			return nil, "", fmt.Errorf("внутренняя ошибка при регистрации клиента")
+		}
+	}
+
+	if err := uc.oauthRepository.CreateOAuthClient(ctx, client); err != nil {
+		return nil, "", fmt.Errorf("внутренняя ошибка при регистрации клиента")
+	}
+
+	slog.Info(op, "OAuth клиент зарегистрирован",
+		slog.String("client_id", client.ID),
+		slog.Bool("public", public),
+	)
+	return client, secret, nil
+}
+
+// GetClient возвращает клиента, незарегистрированный - domain.ErrOAuthClientNotFound
+func (uc *OAuthUseCase) GetClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	client, err := uc.oauthRepository.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при получении клиента")
+	}
+	if client == nil {
+		return nil, domain.ErrOAuthClientNotFound
+	}
+
+	return client, nil
+}
+
+func (uc *OAuthUseCase) ListClients(ctx context.Context) ([]domain.OAuthClient, error) {
+	clients, err := uc.oauthRepository.ListOAuthClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при получении клиентов")
+	}
+
+	return clients, nil
+}
+
+// DeleteClient удаляет клиента и завершает все выданные ему сессии
+func (uc *OAuthUseCase) DeleteClient(ctx context.Context, clientID string) error {
+	const op = "usecase.oauth.DeleteClient"
+
+	deleted, err := uc.oauthRepository.DeleteOAuthClient(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при удалении клиента")
+	}
+	if !deleted {
+		return domain.ErrOAuthClientNotFound
+	}
+
+	slog.Info(op, "OAuth клиент удалён, его сессии завершены", slog.String("client_id", clientID))
+	return nil
+}
+
+// ValidateAuthorization проверяет запрос авторизации и возвращает клиента. Пустой redirect_uri
+// заменяется единственным зарегистрированным. Ошибки domain.ErrOAuthClientNotFound и
+// domain.ErrInvalidRedirectURI нельзя возвращать на redirect_uri, остальные - можно (RFC 6749, раздел 4.1.2.1)
+func (uc *OAuthUseCase) ValidateAuthorization(ctx context.Context, req *domain.AuthorizationRequest) (*domain.OAuthClient, error) {
+	client, err := uc.GetClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, domain.ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return nil, domain.ErrUnsupportedResponseType
+	}
+	// PKCE обязателен для всех клиентов, в том числе конфиденциальных
+	if req.CodeChallengeMethod != domain.CodeChallengeMethodS256 || !validPKCEValue(req.CodeChallenge) {
+		return nil, domain.ErrInvalidOAuthRequest
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, domain.ErrScopeNotAllowed
+		}
+	}
+
+	return client, nil
+}
+
+// Authorize выдаёт код авторизации после согласия пользователя. amr - методы аутентификации
+// пользователя, они переходят в сессию клиента. Если у пользователя включён второй фактор,
+// а amr не содержит jwt.AMRMultiFactor, код не выдаётся: domain.ErrMFARequired.
+// Без запрошенных scopes выдаются scopes клиента, доступные пользователю
+func (uc *OAuthUseCase) Authorize(ctx context.Context, userID uuid.UUID, amr []string, req *domain.AuthorizationRequest) (string, error) {
+	const op = "usecase.oauth.Authorize"
+
+	client, err := uc.ValidateAuthorization(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.Contains(amr, jwt.AMRMultiFactor) {
+		enabled, err := uc.mfaRepository.IsMFAEnabled(ctx, userID.String())
+		if err != nil {
+			return "", fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+		}
+		if enabled {
+			return "", domain.ErrMFARequired
+		}
+	}
+
+	userClaims, err := uc.claimsProvider.UserClaims(ctx, userID)
+	if err != nil {
+		slog.Error(op, "ошибка при получении прав пользователя", slog.String("error", err.Error()))
+		return "", fmt.Errorf("внутренняя ошибка при получении прав пользователя")
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = userClaims.NarrowScopes(client.Scopes)
+	} else if scopes, err = userClaims.GrantScopes(scopes); err != nil {
+		return "", err
+	}
+	// Пустой список scopes при выпуске токенов означает все scopes пользователя, а не клиента
+	if len(scopes) == 0 {
+		return "", domain.ErrScopeNotAllowed
+	}
+
+	code, codeHash, err := newOneTimeToken()
+	if err != nil {
+		slog.Error(op, "ошибка при генерации кода авторизации", slog.String("error", err.Error()))
+		return "", fmt.Errorf("внутренняя ошибка при выдаче кода авторизации")
+	}
+
+	now := time.Now()
+	err = uc.oauthRepository.SaveAuthorizationCode(ctx, &domain.AuthorizationCode{
+		CodeHash:      codeHash,
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		AMR:           amr,
+		CodeChallenge: req.CodeChallenge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(uc.codeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("внутренняя ошибка при выдаче кода авторизации")
+	}
+
+	slog.Info(op, "пользователь разрешил доступ клиенту",
+		slog.String("userID", userID.String()),
+		slog.String("client_id", client.ID),
+		slog.Any("scopes", scopes),
+	)
+	return code, nil
+}
+
+// ExchangeCode обменивает код авторизации на пару токенов (grant_type=authorization_code).
+// Код одноразовый и принимается только от клиента, которому выдан, с верным code_verifier.
+// Повторное предъявление кода завершает выданную по нему сессию (RFC 6749, раздел 4.1.2)
+func (uc *OAuthUseCase) ExchangeCode(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string, client domain.ClientInfo) (*domain.OAuthTokens, error) {
+	const op = "usecase.oauth.ExchangeCode"
+
+	oauthClient, err := uc.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	codeHash := hashOneTimeToken(code)
+	authCode, err := uc.oauthRepository.ConsumeAuthorizationCode(ctx, codeHash)
+	if errors.Is(err, domain.ErrAuthorizationCodeReused) {
+		// Код перехвачен или клиент повторяет запрос: выданная по коду сессия уже завершена
+		slog.Warn(op, "повторное предъявление кода авторизации, сессия завершена", slog.String("client_id", oauthClient.ID))
+		return nil, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при обмене кода авторизации")
+	}
+	if authCode == nil {
+		slog.Warn(op, "недействительный код авторизации", slog.String("client_id", oauthClient.ID))
+		return nil, domain.ErrInvalidGrant
+	}
+
+	// redirect_uri в запросе токена необязателен: код и так привязан к клиенту и code_verifier
+	if authCode.ClientID != oauthClient.ID ||
+		(redirectURI != "" && redirectURI != authCode.RedirectURI) ||
+		!verifyCodeChallenge(codeVerifier, authCode.CodeChallenge) {
+		slog.Warn(op, "код авторизации предъявлен с неверными параметрами",
+			slog.String("client_id", oauthClient.ID),
+			slog.String("code_client_id", authCode.ClientID),
+		)
+		return nil, domain.ErrInvalidGrant
+	}
+
+	client.ClientID = oauthClient.ID
+	pair, err := uc.tokenIssuer.GenerateTokens(ctx, authCode.UserID, authCode.Scopes, authCode.AMR, client)
+	if errors.Is(err, domain.ErrMFARequired) || errors.Is(err, domain.ErrScopeNotAllowed) {
+		// Второй фактор включён или права пользователя сократились после согласия
+		return nil, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, claims, err := uc.tokenResponse(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	// Новая сессия открывает семейство с ID своего refresh токена
+	bound, err := uc.oauthRepository.BindAuthorizationCodeFamily(ctx, codeHash, claims.RefreshID)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при обмене кода авторизации")
+	}
+	if !bound {
+		slog.Warn(op, "код авторизации предъявлен повторно во время обмена, сессия завершена", slog.String("client_id", oauthClient.ID))
+		return nil, domain.ErrInvalidGrant
+	}
+
+	return tokens, nil
+}
+
+// RefreshTokens обновляет пару токенов клиента (grant_type=refresh_token). Refresh токен
+// принимается только от клиента, которому выдан
+func (uc *OAuthUseCase) RefreshTokens(ctx context.Context, clientID, clientSecret, refreshToken string, client domain.ClientInfo) (*domain.OAuthTokens, error) {
+	oauthClient, err := uc.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	client.ClientID = oauthClient.ID
+	pair, err := uc.tokenIssuer.RefreshTokens(ctx, refreshToken, client)
+	if err != nil {
+		return nil, domain.ErrInvalidGrant
+	}
+
+	tokens, _, err := uc.tokenResponse(pair)
+	return tokens, err
+}
+
+// authenticateClient проверяет секрет конфиденциального клиента. Публичный клиент
+// предъявляет только client_id, секрет для него - ошибка
+func (uc *OAuthUseCase) authenticateClient(ctx context.Context, clientID, clientSecret string) (*domain.OAuthClient, error) {
+	const op = "usecase.oauth.authenticateClient"
+
+	client, err := uc.oauthRepository.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при аутентификации клиента")
+	}
+	if client == nil {
+		return nil, domain.ErrInvalidClient
+	}
+
+	if client.Public() {
+		if clientSecret != "" {
+			return nil, domain.ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashOneTimeToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		slog.Warn(op, "неверный секрет клиента", slog.String("client_id", clientID))
+		return nil, domain.ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// tokenResponse дополняет пару токенов сроком действия и выданными scopes из access токена
+// и возвращает claims этого токена
+func (uc *OAuthUseCase) tokenResponse(pair *jwt.TokenPair) (*domain.OAuthTokens, *jwt.TokenClaims, error) {
+	const op = "usecase.oauth.tokenResponse"
+
+	claims, err := uc.tokenParser.ParseAccessToken(pair.AccessToken)
+	if err != nil {
+		slog.Error(op, "не удалось разобрать выпущенный access токен", slog.String("error", err.Error()))
+		return nil, nil, fmt.Errorf("внутренняя ошибка при выпуске токенов")
+	}
+
+	tokens := &domain.OAuthTokens{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: pair.RefreshToken,
+		Scope:        claims.Scope,
+	}
+	if claims.ExpiresAt != nil {
+		tokens.ExpiresIn = int64(time.Until(claims.ExpiresAt.Time).Round(time.Second).Seconds())
+	}
+
+	return tokens, claims, nil
+}
+
+// verifyCodeChallenge проверяет code_verifier по code_challenge методом S256 (RFC 7636, раздел 4.6)
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// validPKCEValue проверяет формат code_verifier и code_challenge: от 43 до 128 символов
+// из набора unreserved (RFC 7636, раздел 4.1)
+func validPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+
+	for _, r := range value {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', strings.ContainsRune("-._~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validRedirectURI допускает абсолютные адреса без фрагмента: https, http только для loopback
+// и собственные схемы мобильных приложений в виде обратного домена (RFC 8252, раздел 7)
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || strings.ContainsAny(uri, "# ") {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		ip := net.ParseIP(host)
+		return host == "localhost" || (ip != nil && ip.IsLoopback())
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"strings"
+	"testing"
+)
+
+// challenge вычислен отдельно от кода сервиса:
+// printf %s "$verifier" | openssl dgst -sha256 -binary | base64 | tr '+/' '-_' | tr -d '='
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mJ92P3Eq2S2uSEsJDHAMrXcvsOaXww"
+	testCodeChallenge = "f89DxS4Ce7l2pPdc8p6NzJpM58agdtnUHc6MdcLhen0"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "S256", verifier: testCodeVerifier, challenge: testCodeChallenge, want: true},
+		{name: "другой verifier", verifier: strings.Replace(testCodeVerifier, "d", "e", 1), challenge: testCodeChallenge},
+		{name: "метод plain не принимается", verifier: testCodeVerifier, challenge: testCodeVerifier},
+		{name: "challenge в base64 с выравниванием", verifier: testCodeVerifier, challenge: testCodeChallenge + "="},
+		{name: "пустой verifier", challenge: testCodeChallenge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.verifier, tt.challenge); got != tt.want {
+				t.Fatalf("verifyCodeChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPKCEValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "минимальная длина", value: strings.Repeat("a", 43), want: true},
+		{name: "максимальная длина", value: strings.Repeat("a", 128), want: true},
+		{name: "все разрешённые символы", value: "ABCXYZabcxyz0123456789-._~" + strings.Repeat("a", 17), want: true},
+		{name: "короче 43 символов", value: strings.Repeat("a", 42)},
+		{name: "длиннее 128 символов", value: strings.Repeat("a", 129)},
+		{name: "символ вне unreserved", value: strings.Repeat("a", 42) + "+"},
+		{name: "пробел", value: strings.Repeat("a", 42) + " "},
+		{name: "не ASCII", value: strings.Repeat("a", 41) + "ё"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validPKCEValue(tt.value); got != tt.want {
+				t.Fatalf("validPKCEValue(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
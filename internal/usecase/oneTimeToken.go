@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// issueOneTimeToken выпускает одноразовый токен для ссылки в письме и возвращает его вместе со сроком действия
+func (uc *UserUseCase) issueOneTimeToken(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration) (string, time.Time, error) {
+	const op = "usecase.user.issueOneTimeToken"
+
+	token, hash, err := newOneTimeToken()
+	if err != nil {
+		slog.Error(op, "ошибка при генерации токена", slog.String("error", err.Error()))
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	err = uc.oneTimeTokenRepository.SaveOneTimeToken(ctx, &domain.OneTimeToken{
+		TokenHash: hash,
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, now.Add(ttl), nil
+}
+
+// backgroundEmailTimeout ограничивает фоновую обработку запроса письма, см. inBackground
+const backgroundEmailTimeout = time.Minute
+
+// inBackground выполняет fn в отдельной горутине с контекстом, отвязанным от запроса:
+// ответ уходит сразу и не выдаёт ни задержкой SMTP, ни ошибкой отправки, что адрес зарегистрирован.
+// Ошибки fn должна логировать сама
+func (uc *UserUseCase) inBackground(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, backgroundEmailTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// emailRateLimited сообщает, что письма с токенами purpose отправлялись пользователю слишком часто:
+// чаще ResendCooldown или больше ResendPerHour за последний час
+func (uc *UserUseCase) emailRateLimited(ctx context.Context, userID, purpose string) (bool, error) {
+	now := time.Now()
+
+	count, lastSentAt, err := uc.oneTimeTokenRepository.CountRecentOneTimeTokens(ctx, userID, purpose, now.Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+
+	return count >= uc.verification.ResendPerHour ||
+		(lastSentAt != nil && now.Sub(*lastSentAt) < uc.verification.ResendCooldown), nil
+}
+
+// newOneTimeToken генерирует токен для ссылки в письме: 256 случайных бит в base64url.
+// В БД сохраняется только SHA-256 хеш, поэтому утечка таблицы не даёт рабочих ссылок
+func newOneTimeToken() (token, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashOneTimeToken(token), nil
+}
+
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
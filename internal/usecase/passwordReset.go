@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/pkg/password"
+)
+
+// ForgotPassword отправляет ссылку сброса пароля. Запрос обрабатывается в фоне, поэтому ответ
+// не зависит от того, зарегистрирован ли email: для неизвестного адреса, при превышении частоты
+// писем и при ошибке отправки письмо просто не уходит, а ошибки только логируются
+func (uc *UserUseCase) ForgotPassword(ctx context.Context, email string) {
+	uc.inBackground(ctx, func(ctx context.Context) {
+		_ = uc.forgotPassword(ctx, email)
+	})
+}
+
+func (uc *UserUseCase) forgotPassword(ctx context.Context, email string) error {
+	const op = "usecase.user.ForgotPassword"
+
+	user, err := uc.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		slog.Debug("сброс пароля для незарегистрированного email", slog.String("op", op))
+		return nil
+	}
+
+	limited, err := uc.emailRateLimited(ctx, user.ID.String(), domain.TokenPurposePasswordReset)
+	if err != nil {
+		slog.Error(op, "ошибка при проверке частоты писем",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if limited {
+		slog.Warn(op, "превышена частота писем сброса пароля", slog.String("user_id", user.ID.String()))
+		return nil
+	}
+
+	token, expiresAt, err := uc.issueOneTimeToken(ctx, user.ID, domain.TokenPurposePasswordReset, uc.verification.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := uc.verification.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Для смены пароля перейдите по ссылке:\n\n%s\n\nСсылка действует до %s и может быть использована один раз. "+
+		"Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.",
+		link, expiresAt.Format("02.01.2006 15:04 MST"))
+
+	if err = uc.emailSender.SendEmail(user.Email, "Сброс пароля", body); err != nil {
+		slog.Error(op, "ошибка при отправке письма",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма и завершает все сессии
+// пользователя: если пароль был скомпрометирован, злоумышленник теряет доступ.
+// Токен гасится в одной транзакции с заменой пароля, поэтому сбой не сжигает ссылку.
+// Уже выданные access токены действуют до истечения своего срока
+func (uc *UserUseCase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	const op = "usecase.user.ResetPassword"
+
+	passwordHash, err := password.Hash(newPassword)
+	if err != nil {
+		slog.Error(op, "ошибка при хешировании пароля", slog.String("error", err.Error()))
+		return fmt.Errorf("внутренняя ошибка при сбросе пароля")
+	}
+
+	userID, err := uc.userRepository.ResetPasswordByToken(ctx, hashOneTimeToken(token), passwordHash)
+	if errors.Is(err, domain.ErrInvalidOneTimeToken) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при сбросе пароля")
+	}
+
+	parsedID, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при сбросе пароля")
+	}
+	if err = uc.tokenIssuer.RevokeAllSessions(ctx, parsedID); err != nil {
+		return err
+	}
+
+	slog.Info(op, "пароль сброшен, сессии завершены", slog.String("user_id", userID))
+	return nil
+}
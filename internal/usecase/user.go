@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/pkg/jwt"
+	"github.com/medods/auth-service/pkg/password"
+)
+
+type UserRepo interface {
+	CreateUser(ctx context.Context, user *domain.User) error
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID string) error
+	ResetPasswordByToken(ctx context.Context, tokenHash, passwordHash string) (string, error)
+}
+
+type OneTimeTokenRepo interface {
+	SaveOneTimeToken(ctx context.Context, token *domain.OneTimeToken) error
+	ConsumeOneTimeToken(ctx context.Context, tokenHash, purpose string) (string, error)
+	ConsumeBoundOneTimeToken(ctx context.Context, tokenHash, nonceHash, purpose string) (string, error)
+	ConsumeOneTimeCode(ctx context.Context, nonceHash, codeHash, purpose string, maxAttempts int) (string, error)
+	CountRecentOneTimeTokens(ctx context.Context, userID, purpose string, since time.Time) (int, *time.Time, error)
+	DeleteOneTimeTokens(ctx context.Context, userID, purpose string) error
+}
+
+type EmailSender interface {
+	SendEmail(to, subject, body string) error
+}
+
+// TokenIssuer открывает и завершает сессии пользователя, реализуется AuthUseCase
+type TokenIssuer interface {
+	GenerateTokens(ctx context.Context, userID uuid.UUID, scopes, amr []string, client domain.ClientInfo) (*jwt.TokenPair, error)
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+type UserUseCase struct {
+	userRepository         UserRepo
+	oneTimeTokenRepository OneTimeTokenRepo
+	tokenIssuer            TokenIssuer
+	emailSender            EmailSender
+	baseURL                string // публичный адрес сервиса для ссылок в письмах
+	verification           config.VerificationConfig
+	dummyHash              string // сверяется при входе с незарегистрированным email, чтобы время ответа не выдавало его
+}
+
+func NewUserUseCase(
+	userRepo UserRepo,
+	oneTimeTokenRepo OneTimeTokenRepo,
+	tokenIssuer TokenIssuer,
+	emailSender EmailSender,
+	baseURL string,
+	verificationCfg config.VerificationConfig,
+) (*UserUseCase, error) {
+	dummyHash, err := password.Hash(uuid.NewString())
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserUseCase{
+		userRepository:         userRepo,
+		oneTimeTokenRepository: oneTimeTokenRepo,
+		tokenIssuer:            tokenIssuer,
+		emailSender:            emailSender,
+		baseURL:                baseURL,
+		verification:           verificationCfg,
+		dummyHash:              dummyHash,
+	}, nil
+}
+
+// Register создаёт пользователя и в фоне отправляет письмо подтверждения email. Результат не зависит
+// от того, занят ли email: вместо регистрации владельцу существующего аккаунта уходит письмо
+// о попытке регистрации, поэтому по ответу нельзя проверить, зарегистрирован ли адрес.
+// Сессию открывает последующий вход
+func (uc *UserUseCase) Register(ctx context.Context, email, plainPassword string) error {
+	const op = "usecase.user.Register"
+
+	// Хеш считается и для занятого email, чтобы время ответа не выдавало существующий аккаунт
+	passwordHash, err := password.Hash(plainPassword)
+	if err != nil {
+		slog.Error(op, "ошибка при хешировании пароля", slog.String("error", err.Error()))
+		return fmt.Errorf("внутренняя ошибка при регистрации пользователя")
+	}
+
+	now := time.Now()
+	user := domain.NewUser(normalizeEmail(email))
+	user.PasswordHash = passwordHash
+	user.CreatedAt, user.UpdatedAt = now, now
+
+	if err = uc.userRepository.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, domain.ErrUserExists) {
+			uc.inBackground(ctx, func(ctx context.Context) {
+				_ = uc.sendAccountExistsEmail(ctx, user.Email)
+			})
+			return nil
+		}
+		return fmt.Errorf("внутренняя ошибка при регистрации пользователя")
+	}
+
+	slog.Info(op, "пользователь зарегистрирован", slog.String("user_id", user.ID.String()))
+
+	// Письмо можно запросить повторно, поэтому ошибка отправки не отменяет регистрацию
+	uc.inBackground(ctx, func(ctx context.Context) {
+		_ = uc.sendVerificationEmail(ctx, user)
+	})
+
+	return nil
+}
+
+// sendAccountExistsEmail сообщает владельцу аккаунта о попытке зарегистрироваться с его email
+// и прикладывает ссылку сброса пароля. Частота писем ограничена так же, как у сброса пароля
+func (uc *UserUseCase) sendAccountExistsEmail(ctx context.Context, email string) error {
+	const op = "usecase.user.sendAccountExistsEmail"
+
+	user, err := uc.userRepository.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	limited, err := uc.emailRateLimited(ctx, user.ID.String(), domain.TokenPurposePasswordReset)
+	if err != nil {
+		slog.Error(op, "ошибка при проверке частоты писем",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if limited {
+		slog.Warn(op, "превышена частота писем о повторной регистрации", slog.String("user_id", user.ID.String()))
+		return nil
+	}
+
+	token, expiresAt, err := uc.issueOneTimeToken(ctx, user.ID, domain.TokenPurposePasswordReset, uc.verification.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := uc.verification.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Кто-то попытался зарегистрироваться с этим адресом, но аккаунт с ним уже существует.\n\n"+
+		"Если это были вы, просто войдите. Если вы не помните пароль, задайте новый по ссылке:\n\n%s\n\n"+
+		"Ссылка действует до %s и может быть использована один раз. Если вы не регистрировались, просто проигнорируйте это письмо.",
+		link, expiresAt.Format("02.01.2006 15:04 MST"))
+
+	if err = uc.emailSender.SendEmail(user.Email, "Аккаунт уже существует", body); err != nil {
+		slog.Error(op, "ошибка при отправке письма",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// Login проверяет email и пароль и открывает новую сессию.
+// Неизвестный email и неверный пароль неразличимы: оба дают domain.ErrInvalidCredentials.
+// До подтверждения email scopes сессии ограничены, см. sessionScopes
+func (uc *UserUseCase) Login(ctx context.Context, email, plainPassword string, scopes []string, client domain.ClientInfo) (*jwt.TokenPair, error) {
+	const op = "usecase.user.Login"
+
+	user, err := uc.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при входе")
+	}
+
+	if user == nil {
+		_ = password.Verify(uc.dummyHash, plainPassword)
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	if err = password.Verify(user.PasswordHash, plainPassword); err != nil {
+		if !errors.Is(err, password.ErrMismatch) {
+			slog.Error(op, "невалидный хеш пароля",
+				slog.String("user_id", user.ID.String()),
+				slog.String("error", err.Error()),
+			)
+		}
+		slog.Warn(op, "неверный пароль",
+			slog.String("user_id", user.ID.String()),
+			slog.String("ip", client.IP),
+		)
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	uc.rehashPassword(ctx, user, plainPassword)
+
+	scopes, err = uc.sessionScopes(user, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.tokenIssuer.GenerateTokens(ctx, user.ID, scopes, []string{jwt.AMRPassword}, client)
+}
+
+// rehashPassword переводит хеш bcrypt или Argon2id с устаревшими параметрами на текущие.
+// Ошибка не мешает входу: хеш будет пересчитан при следующем
+func (uc *UserUseCase) rehashPassword(ctx context.Context, user *domain.User, plainPassword string) {
+	const op = "usecase.user.rehashPassword"
+
+	if !password.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	passwordHash, err := password.Hash(plainPassword)
+	if err != nil {
+		slog.Error(op, "ошибка при хешировании пароля", slog.String("error", err.Error()))
+		return
+	}
+
+	if err = uc.userRepository.UpdatePasswordHash(ctx, user.ID.String(), passwordHash); err != nil {
+		return
+	}
+	slog.Debug(op, "хеш пароля пересчитан", slog.String("user_id", user.ID.String()))
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
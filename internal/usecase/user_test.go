@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/internal/domain"
+)
+
+func TestRegisterDoesNotRevealExistingEmail(t *testing.T) {
+	users := &fakeUserRepo{}
+	sender := &fakeEmailSender{sent: make(chan sentEmail, 1)}
+	uc, err := NewUserUseCase(users, &fakeOneTimeTokenRepo{}, &fakeTokenIssuer{}, sender, "https://auth.example.com",
+		config.VerificationConfig{
+			TTL:              time.Hour,
+			PasswordResetTTL: time.Hour,
+			PasswordResetURL: "https://app.example.com/reset",
+			ResendPerHour:    5,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		email       string
+		wantSubject string
+	}{
+		{name: "новый email", email: "user@example.com", wantSubject: "Подтверждение email"},
+		{name: "занятый email", email: "User@Example.com", wantSubject: "Аккаунт уже существует"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := uc.Register(context.Background(), tt.email, "correct horse battery staple"); err != nil {
+				t.Fatalf("Register() error = %v", err)
+			}
+
+			select {
+			case email := <-sender.sent:
+				if email.to != "user@example.com" || email.subject != tt.wantSubject {
+					t.Fatalf("письмо %q на %s, want %q на user@example.com", email.subject, email.to, tt.wantSubject)
+				}
+				if !strings.Contains(email.body, "?token=") {
+					t.Fatalf("в письме нет одноразовой ссылки: %q", email.body)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("письмо не отправлено")
+			}
+		})
+	}
+
+	if n := users.count(); n != 1 {
+		t.Fatalf("создано %d пользователей, want 1", n)
+	}
+}
+
+// fakeUserRepo хранит пользователей по email, как уникальный индекс в БД
+type fakeUserRepo struct {
+	UserRepo
+
+	mu    sync.Mutex
+	users map[string]*domain.User
+}
+
+func (r *fakeUserRepo) CreateUser(_ context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.Email]; ok {
+		return domain.ErrUserExists
+	}
+	if r.users == nil {
+		r.users = make(map[string]*domain.User)
+	}
+	r.users[user.Email] = user
+	return nil
+}
+
+func (r *fakeUserRepo) GetUserByEmail(_ context.Context, email string) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.users[email], nil
+}
+
+func (r *fakeUserRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.users)
+}
+
+type fakeOneTimeTokenRepo struct {
+	OneTimeTokenRepo
+}
+
+func (fakeOneTimeTokenRepo) SaveOneTimeToken(context.Context, *domain.OneTimeToken) error {
+	return nil
+}
+
+func (fakeOneTimeTokenRepo) CountRecentOneTimeTokens(context.Context, string, string, time.Time) (int, *time.Time, error) {
+	return 0, nil, nil
+}
+
+type sentEmail struct {
+	to, subject, body string
+}
+
+type fakeEmailSender struct {
+	sent chan sentEmail
+}
+
+func (s *fakeEmailSender) SendEmail(to, subject, body string) error {
+	s.sent <- sentEmail{to: to, subject: subject, body: body}
+	return nil
+}
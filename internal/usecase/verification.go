@@ -0,0 +1,128 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"net/url"
+	"slices"
+)
+
+// VerifyEmail подтверждает email по токену из письма. Токен одноразовый
+func (uc *UserUseCase) VerifyEmail(ctx context.Context, token string) error {
+	const op = "usecase.user.VerifyEmail"
+
+	userID, err := uc.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, hashOneTimeToken(token), domain.TokenPurposeEmailVerification)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при подтверждении email")
+	}
+	if userID == "" {
+		return domain.ErrInvalidOneTimeToken
+	}
+
+	if err = uc.userRepository.MarkEmailVerified(ctx, userID); err != nil {
+		return fmt.Errorf("внутренняя ошибка при подтверждении email")
+	}
+
+	// Остальные ссылки подтверждения больше не нужны
+	_ = uc.oneTimeTokenRepository.DeleteOneTimeTokens(ctx, userID, domain.TokenPurposeEmailVerification)
+
+	slog.Info(op, "email подтверждён", slog.String("user_id", userID))
+	return nil
+}
+
+// ResendVerification повторно отправляет письмо подтверждения. Запрос обрабатывается в фоне:
+// для неизвестного или уже подтверждённого email, при превышении частоты писем и при ошибке
+// отправки ответ одинаков и по времени, и по содержанию, чтобы по нему нельзя было проверить,
+// зарегистрирован ли адрес
+func (uc *UserUseCase) ResendVerification(ctx context.Context, email string) {
+	uc.inBackground(ctx, func(ctx context.Context) {
+		_ = uc.resendVerification(ctx, email)
+	})
+}
+
+func (uc *UserUseCase) resendVerification(ctx context.Context, email string) error {
+	const op = "usecase.user.ResendVerification"
+
+	user, err := uc.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailVerified {
+		return nil
+	}
+
+	limited, err := uc.emailRateLimited(ctx, user.ID.String(), domain.TokenPurposeEmailVerification)
+	if err != nil {
+		slog.Error(op, "ошибка при проверке частоты писем",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if limited {
+		slog.Warn(op, "превышена частота писем подтверждения", slog.String("user_id", user.ID.String()))
+		return nil
+	}
+
+	return uc.sendVerificationEmail(ctx, user)
+}
+
+// sendVerificationEmail выпускает одноразовый токен подтверждения и отправляет ссылку с ним
+func (uc *UserUseCase) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	const op = "usecase.user.sendVerificationEmail"
+
+	token, expiresAt, err := uc.issueOneTimeToken(ctx, user.ID, domain.TokenPurposeEmailVerification, uc.verification.TTL)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при отправке письма")
+	}
+
+	link := uc.baseURL + "/auth/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Для подтверждения email перейдите по ссылке:\n\n%s\n\nСсылка действует до %s и может быть использована один раз.",
+		link, expiresAt.Format("02.01.2006 15:04 MST"))
+
+	if err = uc.emailSender.SendEmail(user.Email, "Подтверждение email", body); err != nil {
+		slog.Error(op, "ошибка при отправке письма",
+			slog.String("user_id", user.ID.String()),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("внутренняя ошибка при отправке письма")
+	}
+
+	return nil
+}
+
+// sessionScopes ограничивает scopes сессии пользователя с неподтверждённым email, см. unverifiedScopes
+func (uc *UserUseCase) sessionScopes(user *domain.User, requested []string) ([]string, error) {
+	return unverifiedScopes(uc.verification, user, requested)
+}
+
+// unverifiedScopes ограничивает scopes сессии пользователя с неподтверждённым email:
+// в режиме restrict выдаются только UnverifiedScopes, в режиме block вход запрещён
+func unverifiedScopes(verification config.VerificationConfig, user *domain.User, requested []string) ([]string, error) {
+	if user.EmailVerified {
+		return requested, nil
+	}
+
+	allowed := verification.UnverifiedScopes
+	if verification.UnverifiedLogin == config.UnverifiedLoginBlock || len(allowed) == 0 {
+		return nil, domain.ErrEmailNotVerified
+	}
+	if len(requested) == 0 {
+		return slices.Clone(allowed), nil
+	}
+
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if slices.Contains(allowed, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, domain.ErrEmailNotVerified
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,434 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/medods/auth-service/internal/domain"
+	"log/slog"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type WebAuthnRepo interface {
+	SaveWebAuthnCredential(ctx context.Context, credential *domain.WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, credentialID []byte) (*domain.WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]domain.WebAuthnCredential, error)
+	UseWebAuthnCredential(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) (bool, error)
+	DeleteWebAuthnCredential(ctx context.Context, userID string, credentialID []byte) (bool, error)
+	SaveWebAuthnCeremony(ctx context.Context, ceremony *domain.WebAuthnCeremony) error
+	ConsumeWebAuthnCeremony(ctx context.Context, idHash, purpose string) (*domain.WebAuthnCeremony, error)
+}
+
+type WebAuthnUseCase struct {
+	webAuthn           *webauthn.WebAuthn
+	webAuthnRepository WebAuthnRepo
+	userRepository     UserLookup
+	mfaRepository      MFAStatusRepo
+	tokenIssuer        TokenIssuer
+	verification       config.VerificationConfig
+	ceremonyTTL        time.Duration
+	reauthMaxAge       time.Duration
+}
+
+func NewWebAuthnUseCase(
+	webAuthnRepo WebAuthnRepo,
+	userRepo UserLookup,
+	mfaRepo MFAStatusRepo,
+	tokenIssuer TokenIssuer,
+	webAuthnCfg config.WebAuthnConfig,
+	verificationCfg config.VerificationConfig,
+) (*WebAuthnUseCase, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnCfg.CeremonyTTL, TimeoutUVD: webAuthnCfg.CeremonyTTL}
+
+	// Платформенные аутентификаторы (Touch ID, Windows Hello, Android) с проверкой пользователя:
+	// ключ доступа заменяет и пароль, и второй фактор
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          webAuthnCfg.RPID,
+		RPDisplayName: webAuthnCfg.RPName,
+		RPOrigins:     webAuthnCfg.Origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			AuthenticatorAttachment: protocol.Platform,
+			RequireResidentKey:      protocol.ResidentKeyRequired(),
+			ResidentKey:             protocol.ResidentKeyRequirementRequired,
+			UserVerification:        protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnUseCase{
+		webAuthn:           wa,
+		webAuthnRepository: webAuthnRepo,
+		userRepository:     userRepo,
+		mfaRepository:      mfaRepo,
+		tokenIssuer:        tokenIssuer,
+		verification:       verificationCfg,
+		ceremonyTTL:        webAuthnCfg.CeremonyTTL,
+		reauthMaxAge:       webAuthnCfg.ReauthMaxAge,
+	}, nil
+}
+
+// BeginRegistration начинает регистрацию ключа доступа и возвращает параметры
+// для navigator.credentials.create(). Уже зарегистрированные ключи исключаются.
+// Ключ доступа заменяет пароль и второй фактор, поэтому добавить его можно только сразу после
+// входа: claims access токена должны подтверждать вход не раньше reauthMaxAge назад, а при
+// включённом втором факторе - и его проверку. Иначе domain.ErrReauthenticationRequired
+func (uc *WebAuthnUseCase) BeginRegistration(ctx context.Context, claims *jwt.TokenClaims) (*domain.WebAuthnOptions, error) {
+	const op = "usecase.webauthn.BeginRegistration"
+
+	userID := claims.UserID
+	if err := uc.requireRecentAuthentication(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	user, err := uc.loadUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при регистрации ключа доступа")
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := uc.webAuthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		slog.Error(op, "ошибка при создании параметров регистрации", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при регистрации ключа доступа")
+	}
+
+	return uc.startCeremony(ctx, &userID, domain.WebAuthnCeremonyRegistration, creation, session)
+}
+
+// FinishRegistration проверяет ответ аутентификатора и сохраняет ключ доступа. Свежесть входа
+// повторно не проверяется: церемония привязана к пользователю и начата после этой проверки
+func (uc *WebAuthnUseCase) FinishRegistration(ctx context.Context, userID uuid.UUID, ceremonyID, name string, response []byte) (*domain.WebAuthnCredential, error) {
+	const op = "usecase.webauthn.FinishRegistration"
+
+	session, ceremony, err := uc.finishCeremony(ctx, ceremonyID, domain.WebAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID == nil || *ceremony.UserID != userID {
+		return nil, domain.ErrWebAuthnCeremonyInvalid
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		slog.Warn(op, "невалидный ответ аутентификатора", slog.String("error", err.Error()))
+		return nil, domain.ErrWebAuthnVerification
+	}
+
+	user, err := uc.loadUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при регистрации ключа доступа")
+	}
+
+	created, err := uc.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		slog.Warn(op, "ответ аутентификатора не прошёл проверку",
+			slog.String("userID", userID.String()),
+			slog.String("error", webAuthnErrorInfo(err)),
+		)
+		return nil, domain.ErrWebAuthnVerification
+	}
+
+	transports := make([]string, 0, len(created.Transport))
+	for _, transport := range created.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	credential := &domain.WebAuthnCredential{
+		ID:              created.ID,
+		UserID:          userID,
+		Name:            name,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		Transports:      transports,
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       created.Authenticator.SignCount,
+		BackupEligible:  created.Flags.BackupEligible,
+		BackupState:     created.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+
+	err = uc.webAuthnRepository.SaveWebAuthnCredential(ctx, credential)
+	if errors.Is(err, domain.ErrWebAuthnCredentialExists) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при регистрации ключа доступа")
+	}
+
+	slog.Info(op, "ключ доступа зарегистрирован", slog.String("userID", userID.String()))
+	return credential, nil
+}
+
+// BeginLogin начинает вход по ключу доступа и возвращает параметры для navigator.credentials.get().
+// Пользователь не указывается: его определяет выбранный в браузере ключ
+func (uc *WebAuthnUseCase) BeginLogin(ctx context.Context) (*domain.WebAuthnOptions, error) {
+	const op = "usecase.webauthn.BeginLogin"
+
+	assertion, session, err := uc.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		slog.Error(op, "ошибка при создании параметров входа", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при входе по ключу доступа")
+	}
+
+	return uc.startCeremony(ctx, nil, domain.WebAuthnCeremonyLogin, assertion, session)
+}
+
+// FinishLogin проверяет подпись аутентификатора и открывает сессию через GenerateTokens.
+// Счётчик подписей должен расти, иначе ключ считается клонированным и вход отклоняется
+func (uc *WebAuthnUseCase) FinishLogin(ctx context.Context, ceremonyID string, response []byte, scopes []string, client domain.ClientInfo) (*jwt.TokenPair, error) {
+	const op = "usecase.webauthn.FinishLogin"
+
+	session, _, err := uc.finishCeremony(ctx, ceremonyID, domain.WebAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		slog.Warn(op, "невалидный ответ аутентификатора", slog.String("error", err.Error()))
+		return nil, domain.ErrWebAuthnVerification
+	}
+
+	var owner *webAuthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, err := uc.webAuthnRepository.GetWebAuthnCredential(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil || !bytes.Equal(stored.UserID[:], userHandle) {
+			return nil, domain.ErrWebAuthnCredentialNotFound
+		}
+
+		if owner, err = uc.loadUser(ctx, stored.UserID); err != nil {
+			return nil, err
+		}
+		return owner, nil
+	}
+
+	_, credential, err := uc.webAuthn.ValidatePasskeyLogin(findUser, *session, parsed)
+	if err != nil {
+		slog.Warn(op, "подпись аутентификатора не прошла проверку", slog.String("error", webAuthnErrorInfo(err)))
+		return nil, domain.ErrWebAuthnVerification
+	}
+
+	used, err := uc.webAuthnRepository.UseWebAuthnCredential(ctx, credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при входе по ключу доступа")
+	}
+	if !used || credential.Authenticator.CloneWarning {
+		slog.Warn(op, "счётчик подписей ключа доступа не вырос, возможно клонирование",
+			slog.String("userID", owner.id.String()),
+			slog.Any("sign_count", credential.Authenticator.SignCount),
+		)
+		return nil, domain.ErrWebAuthnVerification
+	}
+
+	if owner.account != nil {
+		if scopes, err = unverifiedScopes(uc.verification, owner.account, scopes); err != nil {
+			return nil, err
+		}
+	}
+
+	// Проверка пользователя обязательна, поэтому ключ доступа - это сразу два фактора
+	amr := []string{jwt.AMRHardwareKey, jwt.AMRMultiFactor}
+	return uc.tokenIssuer.GenerateTokens(ctx, owner.id, scopes, amr, client)
+}
+
+// ListCredentials возвращает ключи доступа пользователя
+func (uc *WebAuthnUseCase) ListCredentials(ctx context.Context, userID uuid.UUID) ([]domain.WebAuthnCredential, error) {
+	credentials, err := uc.webAuthnRepository.ListWebAuthnCredentials(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при получении ключей доступа")
+	}
+
+	return credentials, nil
+}
+
+// DeleteCredential удаляет ключ доступа пользователя. Чужой ключ, как и несуществующий, -
+// domain.ErrWebAuthnCredentialNotFound
+func (uc *WebAuthnUseCase) DeleteCredential(ctx context.Context, userID uuid.UUID, credentialID []byte) error {
+	const op = "usecase.webauthn.DeleteCredential"
+
+	deleted, err := uc.webAuthnRepository.DeleteWebAuthnCredential(ctx, userID.String(), credentialID)
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при удалении ключа доступа")
+	}
+	if !deleted {
+		return domain.ErrWebAuthnCredentialNotFound
+	}
+
+	slog.Info(op, "ключ доступа удалён", slog.String("userID", userID.String()))
+	return nil
+}
+
+// requireRecentAuthentication проверяет, что пользователь входил не раньше reauthMaxAge назад
+// и, если у него включён второй фактор, прошёл его проверку
+func (uc *WebAuthnUseCase) requireRecentAuthentication(ctx context.Context, claims *jwt.TokenClaims) error {
+	const op = "usecase.webauthn.requireRecentAuthentication"
+
+	if !claims.AuthenticatedWithin(uc.reauthMaxAge) {
+		slog.Warn(op, "вход слишком давний для регистрации ключа доступа", slog.String("userID", claims.UserID.String()))
+		return domain.ErrReauthenticationRequired
+	}
+	if claims.HasAMR(jwt.AMRMultiFactor) {
+		return nil
+	}
+
+	enabled, err := uc.mfaRepository.IsMFAEnabled(ctx, claims.UserID.String())
+	if err != nil {
+		return fmt.Errorf("внутренняя ошибка при проверке второго фактора")
+	}
+	if enabled {
+		slog.Warn(op, "вход без второго фактора, регистрация ключа доступа отклонена", slog.String("userID", claims.UserID.String()))
+		return domain.ErrReauthenticationRequired
+	}
+
+	return nil
+}
+
+// startCeremony сохраняет состояние церемонии до шага finish. Клиент получает
+// случайный ID церемонии, в БД хранится только его хеш
+func (uc *WebAuthnUseCase) startCeremony(ctx context.Context, userID *uuid.UUID, purpose string, options interface{}, session *webauthn.SessionData) (*domain.WebAuthnOptions, error) {
+	const op = "usecase.webauthn.startCeremony"
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при начале церемонии WebAuthn")
+	}
+	rawOptions, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при начале церемонии WebAuthn")
+	}
+
+	ceremonyID, idHash, err := newOneTimeToken()
+	if err != nil {
+		slog.Error(op, "ошибка при генерации ID церемонии", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("внутренняя ошибка при начале церемонии WebAuthn")
+	}
+
+	now := time.Now()
+	err = uc.webAuthnRepository.SaveWebAuthnCeremony(ctx, &domain.WebAuthnCeremony{
+		IDHash:      idHash,
+		UserID:      userID,
+		Purpose:     purpose,
+		SessionData: sessionData,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(uc.ceremonyTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("внутренняя ошибка при начале церемонии WebAuthn")
+	}
+
+	return &domain.WebAuthnOptions{CeremonyID: ceremonyID, Options: rawOptions}, nil
+}
+
+// finishCeremony гасит церемонию и возвращает её состояние. Церемония используется один раз
+func (uc *WebAuthnUseCase) finishCeremony(ctx context.Context, ceremonyID, purpose string) (*webauthn.SessionData, *domain.WebAuthnCeremony, error) {
+	ceremony, err := uc.webAuthnRepository.ConsumeWebAuthnCeremony(ctx, hashOneTimeToken(ceremonyID), purpose)
+	if err != nil {
+		return nil, nil, fmt.Errorf("внутренняя ошибка при завершении церемонии WebAuthn")
+	}
+	if ceremony == nil {
+		return nil, nil, domain.ErrWebAuthnCeremonyInvalid
+	}
+
+	var session webauthn.SessionData
+	if err = json.Unmarshal(ceremony.SessionData, &session); err != nil {
+		return nil, nil, fmt.Errorf("внутренняя ошибка при завершении церемонии WebAuthn")
+	}
+
+	return &session, ceremony, nil
+}
+
+// loadUser собирает пользователя WebAuthn: учётную запись (если есть) и его ключи доступа
+func (uc *WebAuthnUseCase) loadUser(ctx context.Context, userID uuid.UUID) (*webAuthnUser, error) {
+	account, err := uc.userRepository.GetUserByID(ctx, userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := uc.webAuthnRepository.ListWebAuthnCredentials(ctx, userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	user := &webAuthnUser{id: userID, name: userID.String(), account: account}
+	if account != nil {
+		user.name = account.Email
+	}
+	for _, credential := range stored {
+		user.credentials = append(user.credentials, toWebAuthnCredential(credential))
+	}
+
+	return user, nil
+}
+
+// webAuthnUser - пользователь в терминах библиотеки WebAuthn. User handle - UUID пользователя
+type webAuthnUser struct {
+	id          uuid.UUID
+	name        string
+	account     *domain.User // nil для пользователей без учётной записи
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.id[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func toWebAuthnCredential(credential domain.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+	for _, transport := range credential.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+
+	return webauthn.Credential{
+		ID:              credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: credential.BackupEligible,
+			BackupState:    credential.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    credential.AAGUID,
+			SignCount: credential.SignCount,
+		},
+	}
+}
+
+// webAuthnErrorInfo дополняет ошибку библиотеки подробностями для лога
+func webAuthnErrorInfo(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		return protocolErr.Error() + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
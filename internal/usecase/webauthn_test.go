@@ -0,0 +1,469 @@
+package usecase
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/internal/config"
+	"github.com/medods/auth-service/internal/domain"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+const (
+	testRPID   = "auth.example.com"
+	testOrigin = "https://auth.example.com"
+)
+
+func TestWebAuthnBeginRegistrationRequiresRecentAuthentication(t *testing.T) {
+	tests := []struct {
+		name       string
+		authTime   *gojwt.NumericDate
+		amr        []string
+		mfaEnabled bool
+		wantErr    error
+	}{
+		{
+			name:     "свежий вход без второго фактора",
+			authTime: gojwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			amr:      []string{jwt.AMRPassword},
+		},
+		{
+			name:       "свежий вход со вторым фактором",
+			authTime:   gojwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			amr:        []string{jwt.AMRPassword, jwt.AMROTP, jwt.AMRMultiFactor},
+			mfaEnabled: true,
+		},
+		{
+			name:     "давний вход",
+			authTime: gojwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			amr:      []string{jwt.AMRPassword},
+			wantErr:  domain.ErrReauthenticationRequired,
+		},
+		{
+			name:    "токен без auth_time",
+			amr:     []string{jwt.AMRPassword},
+			wantErr: domain.ErrReauthenticationRequired,
+		},
+		{
+			name:       "второй фактор включён, но не пройден",
+			authTime:   gojwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			amr:        []string{jwt.AMRPassword},
+			mfaEnabled: true,
+			wantErr:    domain.ErrReauthenticationRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newWebAuthnTestEnv(t)
+			env.mfa.enabled = tt.mfaEnabled
+
+			claims := &jwt.TokenClaims{UserID: env.user.ID, AMR: tt.amr, AuthTime: tt.authTime}
+
+			_, err := env.uc.BeginRegistration(context.Background(), claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BeginRegistration() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && len(env.repo.ceremonies) != 0 {
+				t.Fatalf("церемония начата несмотря на отказ")
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	ctx := context.Background()
+	authenticator := newSoftAuthenticator(t)
+
+	credential := env.register(t, authenticator)
+	if credential.UserID != env.user.ID {
+		t.Fatalf("ключ сохранён для %s, want %s", credential.UserID, env.user.ID)
+	}
+	if len(env.repo.credentials) != 1 {
+		t.Fatalf("сохранено ключей: %d, want 1", len(env.repo.credentials))
+	}
+
+	tokens, err := env.login(t, authenticator, env.user.ID)
+	if err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if tokens == nil {
+		t.Fatal("FinishLogin() не вернул токены")
+	}
+	if env.issuer.userID != env.user.ID {
+		t.Fatalf("сессия открыта для %s, want %s", env.issuer.userID, env.user.ID)
+	}
+	wantAMR := []string{jwt.AMRHardwareKey, jwt.AMRMultiFactor}
+	if len(env.issuer.amr) != len(wantAMR) || env.issuer.amr[0] != wantAMR[0] || env.issuer.amr[1] != wantAMR[1] {
+		t.Fatalf("amr = %v, want %v", env.issuer.amr, wantAMR)
+	}
+
+	// Завершить одну церемонию дважды нельзя
+	options, err := env.uc.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	response := authenticator.assert(t, options, env.user.ID)
+	if _, err = env.uc.FinishLogin(ctx, options.CeremonyID, response, nil, domain.ClientInfo{}); err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	_, err = env.uc.FinishLogin(ctx, options.CeremonyID, response, nil, domain.ClientInfo{})
+	if !errors.Is(err, domain.ErrWebAuthnCeremonyInvalid) {
+		t.Fatalf("повторный FinishLogin() error = %v, want %v", err, domain.ErrWebAuthnCeremonyInvalid)
+	}
+}
+
+func TestWebAuthnLoginRejectsSignCountRegression(t *testing.T) {
+	tests := []struct {
+		name      string
+		signCount uint32
+		wantErr   error
+	}{
+		{name: "счётчик вырос", signCount: 12},
+		{name: "счётчик не изменился", signCount: 11, wantErr: domain.ErrWebAuthnVerification},
+		{name: "счётчик уменьшился", signCount: 3, wantErr: domain.ErrWebAuthnVerification},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newWebAuthnTestEnv(t)
+			authenticator := newSoftAuthenticator(t)
+			env.register(t, authenticator)
+
+			// Подпись со счётчиком 11
+			authenticator.signCount = 10
+			if _, err := env.login(t, authenticator, env.user.ID); err != nil {
+				t.Fatalf("FinishLogin() error = %v", err)
+			}
+
+			// Клон ключа со своим счётчиком
+			authenticator.signCount = tt.signCount - 1
+			_, err := env.login(t, authenticator, env.user.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FinishLogin() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLoginRejectsForeignUserHandle(t *testing.T) {
+	env := newWebAuthnTestEnv(t)
+	authenticator := newSoftAuthenticator(t)
+	env.register(t, authenticator)
+
+	_, err := env.login(t, authenticator, uuid.New())
+	if !errors.Is(err, domain.ErrWebAuthnVerification) {
+		t.Fatalf("FinishLogin() error = %v, want %v", err, domain.ErrWebAuthnVerification)
+	}
+}
+
+type webAuthnTestEnv struct {
+	uc     *WebAuthnUseCase
+	repo   *fakeWebAuthnRepo
+	mfa    *fakeMFAStatusRepo
+	issuer *fakeTokenIssuer
+	user   *domain.User
+}
+
+func newWebAuthnTestEnv(t *testing.T) *webAuthnTestEnv {
+	t.Helper()
+
+	user := &domain.User{ID: uuid.New(), Email: "user@example.com", EmailVerified: true}
+	repo := &fakeWebAuthnRepo{ceremonies: map[string]*domain.WebAuthnCeremony{}}
+	mfa := &fakeMFAStatusRepo{}
+	issuer := &fakeTokenIssuer{}
+
+	uc, err := NewWebAuthnUseCase(repo, fakeUserLookup{user: user}, mfa, issuer, config.WebAuthnConfig{
+		RPID:         testRPID,
+		RPName:       "Auth Service",
+		Origins:      []string{testOrigin},
+		CeremonyTTL:  5 * time.Minute,
+		ReauthMaxAge: 5 * time.Minute,
+	}, config.VerificationConfig{})
+	if err != nil {
+		t.Fatalf("NewWebAuthnUseCase() error = %v", err)
+	}
+
+	return &webAuthnTestEnv{uc: uc, repo: repo, mfa: mfa, issuer: issuer, user: user}
+}
+
+// register проводит регистрацию ключа authenticator сразу после входа по паролю
+func (env *webAuthnTestEnv) register(t *testing.T, authenticator *softAuthenticator) *domain.WebAuthnCredential {
+	t.Helper()
+	ctx := context.Background()
+
+	claims := &jwt.TokenClaims{UserID: env.user.ID, AMR: []string{jwt.AMRPassword}, AuthTime: gojwt.NewNumericDate(time.Now())}
+
+	options, err := env.uc.BeginRegistration(ctx, claims)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+
+	credential, err := env.uc.FinishRegistration(ctx, env.user.ID, options.CeremonyID, "laptop", authenticator.create(t, options))
+	if err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+
+	return credential
+}
+
+// login проводит вход по ключу authenticator, userHandle - пользователь, которого называет аутентификатор
+func (env *webAuthnTestEnv) login(t *testing.T, authenticator *softAuthenticator, userHandle uuid.UUID) (*jwt.TokenPair, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := env.uc.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+
+	return env.uc.FinishLogin(ctx, options.CeremonyID, authenticator.assert(t, options, userHandle), nil, domain.ClientInfo{})
+}
+
+// softAuthenticator - программный платформенный аутентификатор: ключ ES256, attestation none,
+// проверка пользователя всегда пройдена. signCount увеличивается перед каждой подписью
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err = rand.Read(credentialID); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// create отвечает на параметры navigator.credentials.create()
+func (a *softAuthenticator) create(t *testing.T, options *domain.WebAuthnOptions) []byte {
+	t.Helper()
+
+	var creation protocol.CredentialCreation
+	if err := json.Unmarshal(options.Options, &creation); err != nil {
+		t.Fatalf("разбор параметров регистрации: %v", err)
+	}
+
+	clientData := a.clientData(t, protocol.CreateCeremony, creation.Response.Challenge.String())
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("кодирование ключа COSE: %v", err)
+	}
+
+	authData := a.authenticatorData(0x40) // AT: есть данные ключа
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("кодирование attestationObject: %v", err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"attestationObject": b64(attestationObject),
+	})
+}
+
+// assert отвечает на параметры navigator.credentials.get() подписью ключа
+func (a *softAuthenticator) assert(t *testing.T, options *domain.WebAuthnOptions, userHandle uuid.UUID) []byte {
+	t.Helper()
+
+	var assertion protocol.CredentialAssertion
+	if err := json.Unmarshal(options.Options, &assertion); err != nil {
+		t.Fatalf("разбор параметров входа: %v", err)
+	}
+
+	clientData := a.clientData(t, protocol.AssertCeremony, assertion.Response.Challenge.String())
+	authData := a.authenticatorData(0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("подпись: %v", err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(userHandle[:]),
+	})
+}
+
+// authenticatorData собирает данные аутентификатора: хеш RP ID, флаги UP и UV с extra и счётчик подписей
+func (a *softAuthenticator) authenticatorData(extra byte) []byte {
+	a.signCount++
+
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], 0x01|0x04|extra)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony protocol.CeremonyType, challenge string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatalf("кодирование clientDataJSON: %v", err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatalf("кодирование ответа аутентификатора: %v", err)
+	}
+	return data
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// fakeWebAuthnRepo хранит ключи и церемонии в памяти с той же семантикой, что и PostgreSQL
+type fakeWebAuthnRepo struct {
+	credentials []domain.WebAuthnCredential
+	ceremonies  map[string]*domain.WebAuthnCeremony
+}
+
+func (r *fakeWebAuthnRepo) SaveWebAuthnCredential(_ context.Context, credential *domain.WebAuthnCredential) error {
+	for _, stored := range r.credentials {
+		if string(stored.ID) == string(credential.ID) {
+			return domain.ErrWebAuthnCredentialExists
+		}
+	}
+	r.credentials = append(r.credentials, *credential)
+	return nil
+}
+
+func (r *fakeWebAuthnRepo) GetWebAuthnCredential(_ context.Context, credentialID []byte) (*domain.WebAuthnCredential, error) {
+	for _, stored := range r.credentials {
+		if string(stored.ID) == string(credentialID) {
+			return &stored, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeWebAuthnRepo) ListWebAuthnCredentials(_ context.Context, userID string) ([]domain.WebAuthnCredential, error) {
+	var credentials []domain.WebAuthnCredential
+	for _, stored := range r.credentials {
+		if stored.UserID.String() == userID {
+			credentials = append(credentials, stored)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *fakeWebAuthnRepo) UseWebAuthnCredential(_ context.Context, credentialID []byte, signCount uint32, backupState bool) (bool, error) {
+	for i, stored := range r.credentials {
+		if string(stored.ID) != string(credentialID) {
+			continue
+		}
+		if stored.SignCount >= signCount && (stored.SignCount != 0 || signCount != 0) {
+			return false, nil
+		}
+		r.credentials[i].SignCount, r.credentials[i].BackupState = signCount, backupState
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *fakeWebAuthnRepo) DeleteWebAuthnCredential(_ context.Context, userID string, credentialID []byte) (bool, error) {
+	for i, stored := range r.credentials {
+		if stored.UserID.String() == userID && string(stored.ID) == string(credentialID) {
+			r.credentials = append(r.credentials[:i], r.credentials[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeWebAuthnRepo) SaveWebAuthnCeremony(_ context.Context, ceremony *domain.WebAuthnCeremony) error {
+	r.ceremonies[ceremony.IDHash] = ceremony
+	return nil
+}
+
+func (r *fakeWebAuthnRepo) ConsumeWebAuthnCeremony(_ context.Context, idHash, purpose string) (*domain.WebAuthnCeremony, error) {
+	ceremony, ok := r.ceremonies[idHash]
+	if !ok || ceremony.Purpose != purpose || time.Now().After(ceremony.ExpiresAt) {
+		return nil, nil
+	}
+	delete(r.ceremonies, idHash)
+	return ceremony, nil
+}
+
+type fakeUserLookup struct {
+	user *domain.User
+}
+
+func (l fakeUserLookup) GetUserByID(_ context.Context, userID string) (*domain.User, error) {
+	if l.user == nil || l.user.ID.String() != userID {
+		return nil, nil
+	}
+	return l.user, nil
+}
+
+// fakeTokenIssuer запоминает, кому и с какими методами аутентификации открыта сессия
+type fakeTokenIssuer struct {
+	userID uuid.UUID
+	amr    []string
+}
+
+func (i *fakeTokenIssuer) GenerateTokens(_ context.Context, userID uuid.UUID, _, amr []string, _ domain.ClientInfo) (*jwt.TokenPair, error) {
+	i.userID, i.amr = userID, amr
+	return &jwt.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+func (i *fakeTokenIssuer) RevokeAllSessions(context.Context, uuid.UUID) error {
+	return nil
+}
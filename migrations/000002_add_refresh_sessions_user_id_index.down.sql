@@ -0,0 +1,2 @@
+-- Drop the refresh_sessions user index
+DROP INDEX IF EXISTS refresh_sessions_user_id_created_at_idx;
\ No newline at end of file
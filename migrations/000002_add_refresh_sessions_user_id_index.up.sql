@@ -0,0 +1,3 @@
+-- Index for counting and listing sessions of a user
+CREATE INDEX IF NOT EXISTS refresh_sessions_user_id_created_at_idx
+    ON refresh_sessions (user_id, created_at);
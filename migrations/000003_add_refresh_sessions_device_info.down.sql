@@ -0,0 +1,4 @@
+-- Drop device information columns
+ALTER TABLE refresh_sessions
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS user_agent;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- Device information for the session management API
+ALTER TABLE refresh_sessions
+    ADD COLUMN user_agent   TEXT                     NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE refresh_sessions
+SET last_used_at = created_at
+WHERE created_at IS NOT NULL;
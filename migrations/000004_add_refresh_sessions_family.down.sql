@@ -0,0 +1,6 @@
+-- Drop refresh token families
+DROP INDEX IF EXISTS refresh_sessions_family_id_idx;
+
+ALTER TABLE refresh_sessions
+    DROP COLUMN IF EXISTS consumed_at,
+    DROP COLUMN IF EXISTS family_id;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Refresh token families and tombstones for reuse detection
+ALTER TABLE refresh_sessions
+    ADD COLUMN family_id   VARCHAR(255),
+    ADD COLUMN consumed_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE refresh_sessions
+SET family_id = id
+WHERE family_id IS NULL;
+
+ALTER TABLE refresh_sessions
+    ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS refresh_sessions_family_id_idx
+    ON refresh_sessions (family_id);
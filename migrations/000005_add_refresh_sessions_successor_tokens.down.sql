@@ -0,0 +1,3 @@
+-- Drop successor token pair
+ALTER TABLE refresh_sessions
+    DROP COLUMN IF EXISTS successor_tokens;
\ No newline at end of file
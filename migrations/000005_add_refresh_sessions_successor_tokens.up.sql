@@ -0,0 +1,3 @@
+-- Encrypted successor token pair for the refresh grace period
+ALTER TABLE refresh_sessions
+    ADD COLUMN successor_tokens BYTEA;
@@ -0,0 +1,5 @@
+-- Drop roles and session scopes
+ALTER TABLE refresh_sessions
+    DROP COLUMN IF EXISTS scopes;
+
+DROP TABLE IF EXISTS user_roles;
\ No newline at end of file
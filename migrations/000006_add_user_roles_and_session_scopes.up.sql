@@ -0,0 +1,12 @@
+-- Roles of users, mapped to scopes by AUTH_ROLE_SCOPES
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    UUID                     NOT NULL,
+    role       VARCHAR(64)              NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role)
+);
+
+-- Scopes granted at login, kept across refresh token rotation
+ALTER TABLE refresh_sessions
+    ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Create the users table for email/password accounts
+CREATE TABLE IF NOT EXISTS users
+(
+    id            UUID                     NOT NULL
+        PRIMARY KEY,
+    email         VARCHAR(255)             NOT NULL
+        UNIQUE,
+    password_hash VARCHAR(255)             NOT NULL,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
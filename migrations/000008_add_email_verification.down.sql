@@ -0,0 +1,5 @@
+-- Drop one-time tokens and email verification status
+DROP TABLE IF EXISTS one_time_tokens;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_verified;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- Email verification status of users
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Single-use tokens sent by email (verification links and similar)
+CREATE TABLE IF NOT EXISTS one_time_tokens
+(
+    token_hash  VARCHAR(255)             NOT NULL
+        PRIMARY KEY,
+    user_id     UUID                     NOT NULL
+        REFERENCES users (id) ON DELETE CASCADE,
+    purpose     VARCHAR(64)              NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_one_time_tokens_user_purpose ON one_time_tokens (user_id, purpose, created_at);
@@ -0,0 +1,6 @@
+-- Drop TOTP second factor
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+
+ALTER TABLE refresh_sessions
+    DROP COLUMN IF EXISTS amr;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- Authentication methods used at login, carried over on token refresh
+ALTER TABLE refresh_sessions
+    ADD COLUMN amr TEXT NOT NULL DEFAULT '';
+
+-- TOTP second factor of users
+CREATE TABLE IF NOT EXISTS user_mfa
+(
+    user_id         UUID                     NOT NULL
+        PRIMARY KEY,
+    totp_secret     BYTEA                    NOT NULL,
+    enabled         BOOLEAN                  NOT NULL DEFAULT FALSE,
+    last_used_step  BIGINT                   NOT NULL DEFAULT 0,
+    failed_attempts INTEGER                  NOT NULL DEFAULT 0,
+    last_failed_at  TIMESTAMP WITH TIME ZONE,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    enabled_at      TIMESTAMP WITH TIME ZONE
+);
+
+-- Single-use recovery codes for a lost authenticator
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes
+(
+    user_id   UUID                     NOT NULL,
+    code_hash VARCHAR(255)             NOT NULL,
+    used_at   TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (user_id, code_hash)
+);
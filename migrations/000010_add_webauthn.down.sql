@@ -0,0 +1,3 @@
+-- Drop WebAuthn credentials and ceremonies
+DROP TABLE IF EXISTS webauthn_ceremonies;
+DROP TABLE IF EXISTS webauthn_credentials;
\ No newline at end of file
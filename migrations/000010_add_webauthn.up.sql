@@ -0,0 +1,31 @@
+-- WebAuthn credentials (passkeys) of users
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id               BYTEA                    NOT NULL
+        PRIMARY KEY,
+    user_id          UUID                     NOT NULL,
+    name             VARCHAR(255)             NOT NULL DEFAULT '',
+    public_key       BYTEA                    NOT NULL,
+    attestation_type VARCHAR(64)              NOT NULL DEFAULT '',
+    transports       TEXT                     NOT NULL DEFAULT '',
+    aaguid           BYTEA,
+    sign_count       BIGINT                   NOT NULL DEFAULT 0,
+    backup_eligible  BOOLEAN                  NOT NULL DEFAULT FALSE,
+    backup_state     BOOLEAN                  NOT NULL DEFAULT FALSE,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at     TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+-- Pending registration and login ceremonies, each is used once
+CREATE TABLE IF NOT EXISTS webauthn_ceremonies
+(
+    id_hash      VARCHAR(255)             NOT NULL
+        PRIMARY KEY,
+    user_id      UUID,
+    purpose      VARCHAR(64)              NOT NULL,
+    session_data JSONB                    NOT NULL,
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at   TIMESTAMP WITH TIME ZONE NOT NULL
+);
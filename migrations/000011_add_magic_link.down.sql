@@ -0,0 +1,7 @@
+-- Drop passwordless login by email
+DROP INDEX IF EXISTS idx_one_time_tokens_nonce;
+
+ALTER TABLE one_time_tokens
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS code_hash,
+    DROP COLUMN IF EXISTS nonce_hash;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- Passwordless login by email: the login is bound to the requesting device by a nonce cookie,
+-- the email carries a link token (token_hash) and a short code checked with limited attempts
+ALTER TABLE one_time_tokens
+    ADD COLUMN nonce_hash VARCHAR(255),
+    ADD COLUMN code_hash  VARCHAR(255),
+    ADD COLUMN attempts   INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_one_time_tokens_nonce ON one_time_tokens (nonce_hash) WHERE nonce_hash IS NOT NULL;
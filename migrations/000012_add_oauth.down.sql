@@ -0,0 +1,8 @@
+-- Drop OAuth 2.0 clients and authorization codes
+DROP INDEX IF EXISTS idx_refresh_sessions_client_id;
+
+ALTER TABLE refresh_sessions
+    DROP COLUMN IF EXISTS client_id;
+
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
\ No newline at end of file
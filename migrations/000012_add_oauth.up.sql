@@ -0,0 +1,33 @@
+-- OAuth 2.0 clients (third-party applications). Public clients have no secret and rely on PKCE
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id            VARCHAR(64)              NOT NULL
+        PRIMARY KEY,
+    secret_hash   VARCHAR(255),
+    name          VARCHAR(255)             NOT NULL,
+    redirect_uris TEXT                     NOT NULL,
+    scopes        TEXT                     NOT NULL DEFAULT '',
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single-use authorization codes, only the hash of a code is stored
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes
+(
+    code_hash      VARCHAR(255)             NOT NULL
+        PRIMARY KEY,
+    client_id      VARCHAR(64)              NOT NULL
+        REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id        UUID                     NOT NULL,
+    redirect_uri   TEXT                     NOT NULL,
+    scopes         TEXT                     NOT NULL DEFAULT '',
+    amr            TEXT                     NOT NULL DEFAULT '',
+    code_challenge VARCHAR(128)             NOT NULL,
+    created_at     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at     TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Client a session was issued to, empty for the service's own applications
+ALTER TABLE refresh_sessions
+    ADD COLUMN client_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_refresh_sessions_client_id ON refresh_sessions (client_id) WHERE client_id <> '';
@@ -0,0 +1,2 @@
+-- Drop redeemed MFA challenge tokens
+DROP TABLE IF EXISTS mfa_challenge_redemptions;
\ No newline at end of file
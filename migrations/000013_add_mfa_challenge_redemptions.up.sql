@@ -0,0 +1,8 @@
+-- Redeemed MFA challenge tokens (jti), kept until the token expires so it cannot be used twice
+CREATE TABLE IF NOT EXISTS mfa_challenge_redemptions
+(
+    jti         UUID                     NOT NULL
+        PRIMARY KEY,
+    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    redeemed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+-- Drop authorization code reuse detection
+ALTER TABLE oauth_authorization_codes
+    DROP COLUMN IF EXISTS family_id,
+    DROP COLUMN IF EXISTS reused_at,
+    DROP COLUMN IF EXISTS used_at;
\ No newline at end of file
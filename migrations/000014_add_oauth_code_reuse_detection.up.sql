@@ -0,0 +1,5 @@
+-- Used authorization codes are kept to detect reuse and revoke the session issued from the code
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN used_at   TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN reused_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN family_id VARCHAR(255) NOT NULL DEFAULT '';
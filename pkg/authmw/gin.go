@@ -0,0 +1,101 @@
+package authmw
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// ClaimsKey - ключ, под которым claims проверенного токена лежат в gin контексте
+const ClaimsKey = "authmw.claims"
+
+// RequireToken пропускает запросы с валидным access токеном в заголовке
+// Authorization: Bearer и кладёт его claims в контекст запроса.
+// Claims доступны и через Claims(c), и через ClaimsFromContext(c.Request.Context())
+func (a *Authenticator) RequireToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := a.authenticate(c.Request)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+		c.Request = c.Request.WithContext(ContextWithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// RequireScopes пропускает запросы, access токен которых содержит все перечисленные scopes.
+// Ставится после RequireToken
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := Claims(c)
+		if !ok {
+			abort(c, errNoClaims)
+			return
+		}
+
+		if authErr := checkScopes(claims, scopes); authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRoles пропускает запросы пользователей, у которых есть хотя бы одна из ролей.
+// Ставится после RequireToken
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := Claims(c)
+		if !ok {
+			abort(c, errNoClaims)
+			return
+		}
+
+		if authErr := checkRoles(claims, roles); authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireMFA пропускает запросы, access токен которых выдан после проверки второго фактора.
+// Ставится после RequireToken перед чувствительными операциями
+func RequireMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := Claims(c)
+		if !ok {
+			abort(c, errNoClaims)
+			return
+		}
+
+		if authErr := checkMFA(claims); authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Claims возвращает claims, сохранённые RequireToken
+func Claims(c *gin.Context) (*jwt.TokenClaims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+
+	claims, ok := value.(*jwt.TokenClaims)
+	return claims, ok && claims != nil
+}
+
+func abort(c *gin.Context, authErr *authError) {
+	if authErr.challenge != "" {
+		c.Header("WWW-Authenticate", authErr.challenge)
+	}
+	c.AbortWithStatusJSON(authErr.status, gin.H{"error": authErr.message})
+}
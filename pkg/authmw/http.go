@@ -0,0 +1,103 @@
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type claimsContextKey struct{}
+
+// ContextWithClaims возвращает контекст с claims проверенного токена
+func ContextWithClaims(ctx context.Context, claims *jwt.TokenClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext возвращает claims, сохранённые Middleware или RequireToken
+func ClaimsFromContext(ctx context.Context) (*jwt.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*jwt.TokenClaims)
+	return claims, ok && claims != nil
+}
+
+// Middleware - net/http аналог RequireToken: пропускает запросы с валидным access токеном
+// и кладёт его claims в context.Context запроса
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, authErr := a.authenticate(r)
+		if authErr != nil {
+			writeError(w, authErr)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+// ScopesMiddleware - net/http аналог RequireScopes. Ставится после Middleware
+func ScopesMiddleware(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeError(w, errNoClaims)
+				return
+			}
+
+			if authErr := checkScopes(claims, scopes); authErr != nil {
+				writeError(w, authErr)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RolesMiddleware - net/http аналог RequireRoles. Ставится после Middleware
+func RolesMiddleware(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeError(w, errNoClaims)
+				return
+			}
+
+			if authErr := checkRoles(claims, roles); authErr != nil {
+				writeError(w, authErr)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MFAMiddleware - net/http аналог RequireMFA. Ставится после Middleware
+func MFAMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			writeError(w, errNoClaims)
+			return
+		}
+
+		if authErr := checkMFA(claims); authErr != nil {
+			writeError(w, authErr)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, authErr *authError) {
+	if authErr.challenge != "" {
+		w.Header().Set("WWW-Authenticate", authErr.challenge)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(authErr.status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": authErr.message})
+}
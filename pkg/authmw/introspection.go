@@ -0,0 +1,136 @@
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// ErrIntrospectionFailed - сервис авторизации не ответил на запрос интроспекции
+var ErrIntrospectionFailed = errors.New("token introspection failed")
+
+// Introspector проверяет токен на стороне auth-service с учётом отзыва сессии
+type Introspector interface {
+	Introspect(ctx context.Context, token string) (*jwt.TokenClaims, error)
+}
+
+// introspectionResponse - ответ /auth/introspect (RFC 7662)
+type introspectionResponse struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type"`
+	Subject   string   `json:"sub"`
+	Scope     string   `json:"scope"`
+	Roles     []string `json:"roles"`
+	AMR       []string `json:"amr"`
+	ClientID  string   `json:"client_id"`
+	SessionID string   `json:"sid"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	AuthTime  int64    `json:"auth_time"`
+}
+
+// RemoteIntrospector обращается к /auth/introspect по HTTP с Basic авторизацией клиента
+type RemoteIntrospector struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+}
+
+// NewRemoteIntrospector создаёт клиент интроспекции. endpoint - полный адрес,
+// например https://auth.example.com/auth/introspect. При httpClient == nil
+// используется клиент с таймаутом 5 секунд
+func NewRemoteIntrospector(endpoint, clientID, clientSecret string, httpClient *http.Client) *RemoteIntrospector {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	return &RemoteIntrospector{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+	}
+}
+
+// Introspect возвращает claims активного access токена. Неактивный токен или токен
+// другого типа - jwt.ErrInvalidToken и jwt.ErrNotAccessToken, сбой запроса - ErrIntrospectionFailed
+func (i *RemoteIntrospector) Introspect(ctx context.Context, token string) (*jwt.TokenClaims, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(i.clientID, i.clientSecret)
+
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: статус ответа %d", ErrIntrospectionFailed, resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+
+	return result.claims()
+}
+
+// claims переводит ответ интроспекции в claims access токена
+func (r *introspectionResponse) claims() (*jwt.TokenClaims, error) {
+	if !r.Active {
+		return nil, jwt.ErrInvalidToken
+	}
+	if r.TokenType != "access_token" {
+		return nil, jwt.ErrNotAccessToken
+	}
+
+	userID, err := uuid.Parse(r.Subject)
+	if err != nil {
+		return nil, jwt.ErrInvalidToken
+	}
+
+	claims := &jwt.TokenClaims{
+		UserID:    userID,
+		RefreshID: r.SessionID,
+		TokenUse:  jwt.TokenUseAccess,
+		Scope:     r.Scope,
+		Roles:     r.Roles,
+		AMR:       r.AMR,
+		ClientID:  r.ClientID,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Subject: r.Subject,
+		},
+	}
+	if r.ExpiresAt > 0 {
+		claims.ExpiresAt = gojwt.NewNumericDate(time.Unix(r.ExpiresAt, 0))
+	}
+	if r.IssuedAt > 0 {
+		claims.IssuedAt = gojwt.NewNumericDate(time.Unix(r.IssuedAt, 0))
+	}
+	if r.AuthTime > 0 {
+		claims.AuthTime = gojwt.NewNumericDate(time.Unix(r.AuthTime, 0))
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,147 @@
+// Package authmw - middleware для сервисов, принимающих access токены auth-service:
+// для gin и для net/http
+package authmw
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// Verifier проверяет access токен локально: *jwt.TokenManager в самом сервисе
+// или *jwt.AccessTokenVerifier с ключами из JWKS у потребителей
+type Verifier interface {
+	ParseAccessToken(accessToken string) (*jwt.TokenClaims, error)
+}
+
+type Options struct {
+	// Introspector используется, если токен не удалось проверить локально
+	// (нет ключа подписи, непрозрачный токен) или Verifier не задан
+	Introspector Introspector
+}
+
+type Authenticator struct {
+	verifier     Verifier
+	introspector Introspector
+}
+
+// New создаёт Authenticator. verifier может быть nil, тогда каждый токен
+// проверяется через интроспекцию
+func New(verifier Verifier, opts Options) *Authenticator {
+	return &Authenticator{
+		verifier:     verifier,
+		introspector: opts.Introspector,
+	}
+}
+
+// authError - отказ в доступе: HTTP статус, сообщение и заголовок WWW-Authenticate
+type authError struct {
+	status    int
+	message   string
+	challenge string
+}
+
+// authenticate достаёт access токен из заголовка Authorization: Bearer и проверяет его
+func (a *Authenticator) authenticate(r *http.Request) (*jwt.TokenClaims, *authError) {
+	const op = "authmw.authenticate"
+
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, &authError{status: http.StatusUnauthorized, message: "требуется access токен", challenge: "Bearer"}
+	}
+
+	claims, err := a.verify(r.Context(), token)
+	switch {
+	case err == nil:
+		return claims, nil
+	case errors.Is(err, jwt.ErrNotAccessToken):
+		return nil, &authError{
+			status:    http.StatusUnauthorized,
+			message:   "ожидается access токен, передан токен другого типа",
+			challenge: `Bearer error="invalid_token"`,
+		}
+	case errors.Is(err, ErrIntrospectionFailed):
+		slog.Error(op, "ошибка интроспекции токена", slog.String("error", err.Error()))
+		return nil, &authError{status: http.StatusServiceUnavailable, message: "сервис авторизации недоступен"}
+	default:
+		return nil, &authError{
+			status:    http.StatusUnauthorized,
+			message:   "неверный или истекший access токен",
+			challenge: `Bearer error="invalid_token"`,
+		}
+	}
+}
+
+// verify проверяет токен локально, а при неудаче - через интроспекцию.
+// Истёкший токен и токен другого типа сразу отклоняются: интроспекция их тоже не примет
+func (a *Authenticator) verify(ctx context.Context, token string) (*jwt.TokenClaims, error) {
+	if a.verifier != nil {
+		claims, err := a.verifier.ParseAccessToken(token)
+		if err == nil || a.introspector == nil ||
+			errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrNotAccessToken) {
+			return claims, err
+		}
+	}
+
+	if a.introspector == nil {
+		return nil, jwt.ErrInvalidToken
+	}
+
+	return a.introspector.Introspect(ctx, token)
+}
+
+// checkScopes требует все перечисленные scopes
+func checkScopes(claims *jwt.TokenClaims, scopes []string) *authError {
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return &authError{
+				status:    http.StatusForbidden,
+				message:   "недостаточно прав: требуется scope " + scope,
+				challenge: `Bearer error="insufficient_scope", scope="` + strings.Join(scopes, " ") + `"`,
+			}
+		}
+	}
+	return nil
+}
+
+// checkRoles требует хотя бы одну из ролей
+func checkRoles(claims *jwt.TokenClaims, roles []string) *authError {
+	for _, role := range roles {
+		if claims.HasRole(role) {
+			return nil
+		}
+	}
+	return &authError{
+		status:  http.StatusForbidden,
+		message: "недостаточно прав: требуется роль " + strings.Join(roles, " или "),
+	}
+}
+
+// checkMFA требует, чтобы при входе был пройден второй фактор (amr содержит mfa).
+// Ответ по RFC 9470: клиент должен заново провести пользователя через вход с MFA
+func checkMFA(claims *jwt.TokenClaims) *authError {
+	if claims.HasAMR(jwt.AMRMultiFactor) {
+		return nil
+	}
+	return &authError{
+		status:    http.StatusUnauthorized,
+		message:   "требуется вход со вторым фактором",
+		challenge: `Bearer error="insufficient_user_authentication", error_description="second factor required"`,
+	}
+}
+
+var errNoClaims = &authError{status: http.StatusUnauthorized, message: "требуется access токен", challenge: "Bearer"}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,350 @@
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	valid := &jwt.TokenClaims{UserID: uuid.New()}
+
+	tests := []struct {
+		name          string
+		header        string
+		verifier      Verifier
+		introspector  *fakeIntrospector
+		wantStatus    int
+		wantChallenge string
+		wantIntrospec bool
+	}{
+		{
+			name:          "нет заголовка",
+			verifier:      fakeVerifier{claims: valid},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+		},
+		{
+			name:          "другая схема",
+			header:        "Basic dXNlcjpwYXNz",
+			verifier:      fakeVerifier{claims: valid},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+		},
+		{
+			name:       "валидный токен",
+			header:     "Bearer token",
+			verifier:   fakeVerifier{claims: valid},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "схема в нижнем регистре",
+			header:     "bearer token",
+			verifier:   fakeVerifier{claims: valid},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "токен другого типа",
+			header:        "Bearer token",
+			verifier:      fakeVerifier{err: jwt.ErrNotAccessToken},
+			introspector:  &fakeIntrospector{claims: valid},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+		},
+		{
+			name:          "истёкший токен не отправляется на интроспекцию",
+			header:        "Bearer token",
+			verifier:      fakeVerifier{err: jwt.ErrTokenExpired},
+			introspector:  &fakeIntrospector{claims: valid},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+		},
+		{
+			name:          "невалидный токен без интроспекции",
+			header:        "Bearer token",
+			verifier:      fakeVerifier{err: jwt.ErrInvalidToken},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+		},
+		{
+			name:          "неизвестный ключ проверяется интроспекцией",
+			header:        "Bearer token",
+			verifier:      fakeVerifier{err: jwt.ErrInvalidToken},
+			introspector:  &fakeIntrospector{claims: valid},
+			wantStatus:    http.StatusOK,
+			wantIntrospec: true,
+		},
+		{
+			name:          "только интроспекция",
+			header:        "Bearer token",
+			introspector:  &fakeIntrospector{claims: valid},
+			wantStatus:    http.StatusOK,
+			wantIntrospec: true,
+		},
+		{
+			name:          "интроспекция: токен неактивен",
+			header:        "Bearer token",
+			introspector:  &fakeIntrospector{err: jwt.ErrInvalidToken},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+			wantIntrospec: true,
+		},
+		{
+			name:          "сервис авторизации недоступен",
+			header:        "Bearer token",
+			introspector:  &fakeIntrospector{err: fmt.Errorf("%w: timeout", ErrIntrospectionFailed)},
+			wantStatus:    http.StatusServiceUnavailable,
+			wantIntrospec: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			if tt.introspector != nil {
+				opts.Introspector = tt.introspector
+			}
+			auth := New(tt.verifier, opts)
+
+			handlers := map[string]http.Handler{
+				"net/http": auth.Middleware(claimsHandler(t, valid)),
+				"gin":      newTestRouter(auth.RequireToken(), ginClaimsHandler(t, valid)),
+			}
+			for name, handler := range handlers {
+				rec := serve(handler, tt.header)
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("%s: статус = %d, want %d", name, rec.Code, tt.wantStatus)
+				}
+				if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+					t.Fatalf("%s: WWW-Authenticate = %q, want %q", name, got, tt.wantChallenge)
+				}
+			}
+			if tt.introspector != nil && tt.introspector.called != tt.wantIntrospec {
+				t.Fatalf("интроспекция вызвана = %v, want %v", tt.introspector.called, tt.wantIntrospec)
+			}
+		})
+	}
+}
+
+func TestRequireClaims(t *testing.T) {
+	claims := &jwt.TokenClaims{
+		UserID: uuid.New(),
+		Scope:  "profile orders:read",
+		Roles:  []string{"manager"},
+		AMR:    []string{jwt.AMRPassword},
+	}
+	withMFA := &jwt.TokenClaims{UserID: claims.UserID, AMR: []string{jwt.AMRPassword, jwt.AMROTP, jwt.AMRMultiFactor}}
+
+	tests := []struct {
+		name          string
+		claims        *jwt.TokenClaims
+		gin           gin.HandlerFunc
+		http          func(http.Handler) http.Handler
+		wantStatus    int
+		wantChallenge string
+	}{
+		{
+			name:       "все scopes выданы",
+			claims:     claims,
+			gin:        RequireScopes("profile", "orders:read"),
+			http:       ScopesMiddleware("profile", "orders:read"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "не хватает scope",
+			claims:        claims,
+			gin:           RequireScopes("profile", "orders:write"),
+			http:          ScopesMiddleware("profile", "orders:write"),
+			wantStatus:    http.StatusForbidden,
+			wantChallenge: `Bearer error="insufficient_scope", scope="profile orders:write"`,
+		},
+		{
+			name:       "одна из ролей",
+			claims:     claims,
+			gin:        RequireRoles("admin", "manager"),
+			http:       RolesMiddleware("admin", "manager"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "нет ни одной роли",
+			claims:     claims,
+			gin:        RequireRoles("admin"),
+			http:       RolesMiddleware("admin"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "вход со вторым фактором",
+			claims:     withMFA,
+			gin:        RequireMFA(),
+			http:       MFAMiddleware,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "вход без второго фактора",
+			claims:        claims,
+			gin:           RequireMFA(),
+			http:          MFAMiddleware,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="insufficient_user_authentication", error_description="second factor required"`,
+		},
+		{
+			name:          "не проверен токен",
+			gin:           RequireScopes("profile"),
+			http:          ScopesMiddleware("profile"),
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handlers map[string]http.Handler
+			if tt.claims != nil {
+				auth := New(fakeVerifier{claims: tt.claims}, Options{})
+				handlers = map[string]http.Handler{
+					"net/http": auth.Middleware(tt.http(claimsHandler(t, tt.claims))),
+					"gin":      newTestRouter(auth.RequireToken(), tt.gin, ginClaimsHandler(t, tt.claims)),
+				}
+			} else {
+				// Middleware поставлен без проверки токена
+				handlers = map[string]http.Handler{
+					"net/http": tt.http(claimsHandler(t, nil)),
+					"gin":      newTestRouter(tt.gin, ginClaimsHandler(t, nil)),
+				}
+			}
+
+			for name, handler := range handlers {
+				rec := serve(handler, "Bearer token")
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("%s: статус = %d, want %d", name, rec.Code, tt.wantStatus)
+				}
+				if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+					t.Fatalf("%s: WWW-Authenticate = %q, want %q", name, got, tt.wantChallenge)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteIntrospector(t *testing.T) {
+	userID := uuid.New()
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "billing" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = r.ParseForm()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"active":     r.PostForm.Get("token") == "active",
+			"token_type": "access_token",
+			"sub":        userID.String(),
+			"scope":      "profile",
+			"amr":        []string{jwt.AMRPassword},
+			"exp":        time.Now().Add(time.Minute).Unix(),
+			"auth_time":  authTime.Unix(),
+		})
+	}))
+	defer server.Close()
+
+	introspector := NewRemoteIntrospector(server.URL, "billing", "secret", nil)
+
+	claims, err := introspector.Introspect(context.Background(), "active")
+	if err != nil {
+		t.Fatalf("Introspect() error = %v", err)
+	}
+	if claims.UserID != userID || !claims.HasScope("profile") || !claims.HasAMR(jwt.AMRPassword) {
+		t.Fatalf("Introspect() claims = %+v", claims)
+	}
+	if claims.AuthTime == nil || !claims.AuthTime.Time.Equal(authTime) || !claims.AuthenticatedWithin(time.Hour) {
+		t.Fatalf("AuthTime = %v, want %v", claims.AuthTime, authTime)
+	}
+
+	if _, err = introspector.Introspect(context.Background(), "revoked"); !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Fatalf("Introspect(revoked) error = %v, want %v", err, jwt.ErrInvalidToken)
+	}
+	if _, err = NewRemoteIntrospector(server.URL, "billing", "wrong", nil).Introspect(context.Background(), "active"); !errors.Is(err, ErrIntrospectionFailed) {
+		t.Fatalf("Introspect() с неверным секретом error = %v, want %v", err, ErrIntrospectionFailed)
+	}
+}
+
+func serve(handler http.Handler, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func newTestRouter(handlers ...gin.HandlerFunc) http.Handler {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/", handlers...)
+	return router
+}
+
+// claimsHandler отвечает 200 и проверяет, что до обработчика дошли claims проверенного токена
+func claimsHandler(t *testing.T, want *jwt.TokenClaims) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, _ := ClaimsFromContext(r.Context()); claims != want {
+			t.Errorf("ClaimsFromContext() = %v, want %v", claims, want)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func ginClaimsHandler(t *testing.T, want *jwt.TokenClaims) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, _ := Claims(c); claims != want {
+			t.Errorf("Claims() = %v, want %v", claims, want)
+		}
+		if claims, _ := ClaimsFromContext(c.Request.Context()); claims != want {
+			t.Errorf("ClaimsFromContext() = %v, want %v", claims, want)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+type fakeVerifier struct {
+	claims *jwt.TokenClaims
+	err    error
+}
+
+func (v fakeVerifier) ParseAccessToken(string) (*jwt.TokenClaims, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	return v.claims, nil
+}
+
+type fakeIntrospector struct {
+	claims *jwt.TokenClaims
+	err    error
+	called bool
+}
+
+func (i *fakeIntrospector) Introspect(context.Context, string) (*jwt.TokenClaims, error) {
+	i.called = true
+	if i.err != nil {
+		return nil, i.err
+	}
+	return i.claims, nil
+}
@@ -0,0 +1,285 @@
+// Package client - Go клиент API auth-service
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New создаёт клиент сервиса, baseURL - адрес без завершающего слеша,
+// например https://auth.example.com. При httpClient == nil используется
+// клиент с таймаутом 10 секунд
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Session - сессия (устройство) пользователя
+type Session struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	ClientID   string    `json:"client_id,omitempty"` // стороннее приложение (OAuth клиент)
+	Current    bool      `json:"current"`
+}
+
+// TOTPEnrollment - секрет TOTP для приложения-аутентификатора
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"` // PNG в формате data URI
+}
+
+// Register создаёт пользователя. Ответ одинаков и для занятого email: дальнейшие шаги
+// сервис присылает письмом, а сессию открывает Login
+func (c *Client) Register(ctx context.Context, email, password string) error {
+	body := map[string]string{"email": email, "password": password}
+	return c.do(ctx, http.MethodPost, "/auth/register", "", body, nil)
+}
+
+// Login открывает сессию по email и паролю. Неверные учётные данные - ErrUnauthorized.
+// Если у пользователя включён второй фактор - ErrMFARequired, вход завершает VerifyMFA
+func (c *Client) Login(ctx context.Context, email, password string, scopes ...string) (*jwt.TokenPair, error) {
+	body := map[string]string{"email": email, "password": password}
+	if len(scopes) > 0 {
+		body["scope"] = strings.Join(scopes, " ")
+	}
+
+	var pair jwt.TokenPair
+	if err := c.do(ctx, http.MethodPost, "/auth/login", "", body, &pair); err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// VerifyEmail подтверждает email токеном из письма. Недействительная ссылка - ErrBadRequest
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodGet, "/auth/verify-email?"+url.Values{"token": {token}}.Encode(), "", nil, nil)
+}
+
+// ResendVerification запрашивает повторное письмо подтверждения email. Ошибки нет
+// ни для незарегистрированного email, ни при слишком частых запросах
+func (c *Client) ResendVerification(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/auth/verify-email/resend", "", map[string]string{"email": email}, nil)
+}
+
+// ForgotPassword запрашивает письмо со ссылкой сброса пароля. Ошибки нет
+// и для незарегистрированного email
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/auth/password/forgot", "", map[string]string{"email": email}, nil)
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма. Все сессии пользователя
+// при этом завершаются. Недействительная ссылка - ErrBadRequest
+func (c *Client) ResetPassword(ctx context.Context, token, newPassword string) error {
+	body := map[string]string{"token": token, "password": newPassword}
+	return c.do(ctx, http.MethodPost, "/auth/password/reset", "", body, nil)
+}
+
+// RequestMagicLink запрашивает письмо со ссылкой и кодом для входа без пароля. Вход привязан
+// к устройству cookie, поэтому httpClient клиента должен хранить cookie (http.Client.Jar),
+// а сервис - работать по https. Ошибки нет ни для незарегистрированного email, ни при слишком
+// частых запросах: лишние письма просто не отправляются
+func (c *Client) RequestMagicLink(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/auth/magic-link", "", map[string]string{"email": email}, nil)
+}
+
+// VerifyMagicLink завершает вход токеном из ссылки. Недействительная ссылка - ErrUnauthorized,
+// включённый второй фактор - ErrMFARequired
+func (c *Client) VerifyMagicLink(ctx context.Context, token string, scopes ...string) (*jwt.TokenPair, error) {
+	return c.verifyMagicLink(ctx, map[string]string{"token": token}, scopes)
+}
+
+// VerifyMagicLinkCode завершает вход 6-значным кодом из письма вместо ссылки
+func (c *Client) VerifyMagicLinkCode(ctx context.Context, code string, scopes ...string) (*jwt.TokenPair, error) {
+	return c.verifyMagicLink(ctx, map[string]string{"code": code}, scopes)
+}
+
+func (c *Client) verifyMagicLink(ctx context.Context, body map[string]string, scopes []string) (*jwt.TokenPair, error) {
+	if len(scopes) > 0 {
+		body["scope"] = strings.Join(scopes, " ")
+	}
+
+	var pair jwt.TokenPair
+	if err := c.do(ctx, http.MethodPost, "/auth/magic-link/verify", "", body, &pair); err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// GenerateTokens выпускает пару токенов и открывает новую сессию. Маршрут служебный
+// и требует административного ключа (ADMIN_API_KEY) сервиса.
+// Без scopes выдаются все scopes, доступные пользователю
+func (c *Client) GenerateTokens(ctx context.Context, adminKey string, userID uuid.UUID, scopes ...string) (*jwt.TokenPair, error) {
+	query := url.Values{"user_id": {userID.String()}}
+	if len(scopes) > 0 {
+		query.Set("scope", strings.Join(scopes, " "))
+	}
+
+	header := http.Header{"X-Admin-Key": {adminKey}}
+
+	var pair jwt.TokenPair
+	if err := c.send(ctx, http.MethodPost, "/auth/tokens?"+query.Encode(), header, nil, &pair); err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// RefreshTokens обменивает refresh токен на новую пару. Прежний refresh токен
+// после этого недействителен
+func (c *Client) RefreshTokens(ctx context.Context, refreshToken string) (*jwt.TokenPair, error) {
+	body := map[string]string{"refresh_token": refreshToken}
+
+	var pair jwt.TokenPair
+	if err := c.do(ctx, http.MethodPost, "/auth/refresh", "", body, &pair); err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// RevokeToken завершает сессию, к которой относится access или refresh токен
+func (c *Client) RevokeToken(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodPost, "/auth/revoke", "", map[string]string{"token": token}, nil)
+}
+
+// ListSessions возвращает сессии владельца access токена
+func (c *Client) ListSessions(ctx context.Context, accessToken string) ([]Session, error) {
+	var sessions []Session
+	if err := c.do(ctx, http.MethodGet, "/auth/sessions", accessToken, nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает одну сессию владельца access токена
+func (c *Client) RevokeSession(ctx context.Context, accessToken, sessionID string) error {
+	return c.do(ctx, http.MethodDelete, "/auth/sessions/"+url.PathEscape(sessionID), accessToken, nil, nil)
+}
+
+// RevokeAllSessions завершает все сессии владельца access токена
+func (c *Client) RevokeAllSessions(ctx context.Context, accessToken string) error {
+	return c.do(ctx, http.MethodDelete, "/auth/sessions", accessToken, nil, nil)
+}
+
+// VerifyMFA завершает вход с включённым вторым фактором: mfaToken берётся из
+// APIError.MFAToken ответа ErrMFARequired, code - из приложения-аутентификатора
+func (c *Client) VerifyMFA(ctx context.Context, mfaToken, code string) (*jwt.TokenPair, error) {
+	return c.verifyMFA(ctx, map[string]string{"mfa_token": mfaToken, "code": code})
+}
+
+// VerifyMFARecoveryCode завершает вход кодом восстановления вместо кода из приложения
+func (c *Client) VerifyMFARecoveryCode(ctx context.Context, mfaToken, recoveryCode string) (*jwt.TokenPair, error) {
+	return c.verifyMFA(ctx, map[string]string{"mfa_token": mfaToken, "recovery_code": recoveryCode})
+}
+
+func (c *Client) verifyMFA(ctx context.Context, body map[string]string) (*jwt.TokenPair, error) {
+	var pair jwt.TokenPair
+	if err := c.do(ctx, http.MethodPost, "/auth/mfa/verify", "", body, &pair); err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// EnrollTOTP создаёт секрет TOTP для владельца access токена. Второй фактор
+// включается после ConfirmTOTP. Уже включённый второй фактор - ErrConflict
+func (c *Client) EnrollTOTP(ctx context.Context, accessToken string) (*TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	if err := c.do(ctx, http.MethodPost, "/auth/mfa/totp/enroll", accessToken, nil, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// ConfirmTOTP включает второй фактор кодом из приложения и возвращает коды восстановления
+func (c *Client) ConfirmTOTP(ctx context.Context, accessToken, code string) ([]string, error) {
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/auth/mfa/totp/confirm", accessToken, map[string]string{"code": code}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.RecoveryCodes, nil
+}
+
+// DisableTOTP отключает второй фактор. Неверный код - ErrBadRequest
+func (c *Client) DisableTOTP(ctx context.Context, accessToken, code string) error {
+	return c.do(ctx, http.MethodPost, "/auth/mfa/totp/disable", accessToken, map[string]string{"code": code}, nil)
+}
+
+// do выполняет запрос к API от имени владельца accessToken (пустой - без авторизации)
+func (c *Client) do(ctx context.Context, method, path, accessToken string, body, out interface{}) error {
+	header := http.Header{}
+	if accessToken != "" {
+		header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return c.send(ctx, method, path, header, body, out)
+}
+
+// send выполняет запрос к API с заголовками header: body кодируется в JSON, успешный ответ
+// декодируется в out, ответ с ошибкой превращается в *APIError
+func (c *Client) send(ctx context.Context, method, path string, header http.Header, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("auth-service: кодирование запроса: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("auth-service: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("auth-service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errBody errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errBody)
+		return newAPIError(resp.StatusCode, errBody)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("auth-service: декодирование ответа: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Ошибки по кодам ответа сервиса, проверяются через errors.Is
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	// ErrTooManyRequests - превышена частота запросов (429)
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrInvalidScope - запрошен scope, недоступный пользователю (400 invalid_scope)
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrMFARequired - у пользователя включён второй фактор (403 mfa_required),
+	// токен для VerifyMFA - в APIError.MFAToken
+	ErrMFARequired = errors.New("mfa required")
+)
+
+// APIError - ответ сервиса с кодом 4xx/5xx
+type APIError struct {
+	StatusCode int
+	Code       string // код ошибки OAuth (invalid_scope и т.п.), если сервис его вернул
+	Message    string
+	MFAToken   string // токен MFA challenge для VerifyMFA, если Code == mfa_required
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("auth-service: %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("auth-service: %d: %s", e.StatusCode, e.Message)
+}
+
+// Is сопоставляет ошибку с ErrBadRequest, ErrUnauthorized и другими по коду ответа
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrTooManyRequests:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrInvalidScope:
+		return e.Code == "invalid_scope"
+	case ErrMFARequired:
+		return e.Code == "mfa_required"
+	}
+	return false
+}
+
+// errorResponse - тело ответа с ошибкой: {"error": "..."} или
+// {"error": "invalid_scope", "error_description": "..."}
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	MFAToken         string `json:"mfa_token"`
+}
+
+func newAPIError(statusCode int, body errorResponse) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Message: body.Error, MFAToken: body.MFAToken}
+	if body.ErrorDescription != "" {
+		apiErr.Code, apiErr.Message = body.Error, body.ErrorDescription
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(statusCode)
+	}
+	return apiErr
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/medods/auth-service/pkg/jwt"
+)
+
+// TransportOptions - параметры автообновляемого транспорта
+type TransportOptions struct {
+	// Base - транспорт для запросов к API потребителя, по умолчанию http.DefaultTransport
+	Base http.RoundTripper
+	// RefreshBefore - за сколько до истечения access токена его обновлять, по умолчанию 30 секунд
+	RefreshBefore time.Duration
+	// OnRefresh вызывается с новой парой после каждого обновления, например чтобы
+	// сохранить refresh токен: прежний после обновления недействителен
+	OnRefresh func(jwt.TokenPair)
+}
+
+// Transport - http.RoundTripper, который подставляет access токен в заголовок
+// Authorization и незаметно обновляет его незадолго до истечения. Одновременные
+// запросы из разных горутин дожидаются одного общего обновления: refresh токен
+// одноразовый, и параллельный повторный обмен отозвал бы всю сессию
+type Transport struct {
+	client        *Client
+	base          http.RoundTripper
+	refreshBefore time.Duration
+	onRefresh     func(jwt.TokenPair)
+
+	mu        sync.Mutex
+	tokens    jwt.TokenPair
+	expiresAt time.Time // нулевое значение - срок access токена неизвестен
+	inflight  *refreshCall
+}
+
+// refreshCall - выполняющееся обновление токенов, общее для всех ожидающих
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewTransport создаёт транспорт, начиная с пары tokens
+func (c *Client) NewTransport(tokens jwt.TokenPair, opts TransportOptions) *Transport {
+	if opts.Base == nil {
+		opts.Base = http.DefaultTransport
+	}
+	if opts.RefreshBefore <= 0 {
+		opts.RefreshBefore = 30 * time.Second
+	}
+
+	return &Transport{
+		client:        c,
+		base:          opts.Base,
+		refreshBefore: opts.RefreshBefore,
+		onRefresh:     opts.OnRefresh,
+		tokens:        tokens,
+		expiresAt:     tokenExpiry(tokens.AccessToken),
+	}
+}
+
+// HTTPClient возвращает http.Client, запросы которого идут через транспорт
+func (t *Transport) HTTPClient() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	accessToken, err := t.AccessToken(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// RoundTripper не должен изменять исходный запрос
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	return t.base.RoundTrip(req)
+}
+
+// Tokens возвращает текущую пару токенов
+func (t *Transport) Tokens() jwt.TokenPair {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.tokens
+}
+
+// AccessToken возвращает действующий access токен, при необходимости обновив пару
+func (t *Transport) AccessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	if !t.needsRefresh(time.Now()) {
+		accessToken := t.tokens.AccessToken
+		t.mu.Unlock()
+		return accessToken, nil
+	}
+
+	call := t.inflight
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		t.inflight = call
+		go t.refresh(call, t.tokens.RefreshToken)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Если обновить не удалось, ещё не истёкший access токен остаётся пригоден
+	if call.err != nil && (t.expiresAt.IsZero() || !time.Now().Before(t.expiresAt)) {
+		return "", call.err
+	}
+	return t.tokens.AccessToken, nil
+}
+
+// needsRefresh вызывается под mu
+func (t *Transport) needsRefresh(now time.Time) bool {
+	if t.tokens.AccessToken == "" {
+		return true
+	}
+	return !t.expiresAt.IsZero() && !now.Before(t.expiresAt.Add(-t.refreshBefore))
+}
+
+// refresh обменивает refresh токен на новую пару. Выполняется в отдельной горутине
+// со своим контекстом, чтобы отмена запроса одного из ожидающих не прерывала обновление для остальных
+func (t *Transport) refresh(call *refreshCall, refreshToken string) {
+	defer close(call.done)
+
+	pair, err := t.client.RefreshTokens(context.Background(), refreshToken)
+
+	t.mu.Lock()
+	t.inflight = nil
+	if err != nil {
+		call.err = err
+		t.mu.Unlock()
+		return
+	}
+	t.tokens = *pair
+	t.expiresAt = tokenExpiry(pair.AccessToken)
+	t.mu.Unlock()
+
+	if t.onRefresh != nil {
+		t.onRefresh(*pair)
+	}
+}
+
+// tokenExpiry читает exp из access токена без проверки подписи: токен проверяет
+// принимающий сервис, клиенту нужен только срок, чтобы обновить его заранее
+func tokenExpiry(accessToken string) time.Time {
+	var claims jwt.TokenClaims
+	if _, _, err := gojwt.NewParser().ParseUnverified(accessToken, &claims); err != nil || claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
@@ -0,0 +1,216 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK - публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC и OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS - набор публичных ключей, публикуемый на /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK возвращает публичную половину ключа подписи в формате JWK
+func NewJWK(key *SigningKey) (JWK, error) {
+	jwk, err := publicJWK(key.PublicKey)
+	if err != nil {
+		return JWK{}, err
+	}
+
+	jwk.Kid = key.ID
+	jwk.Alg = key.Method.Alg()
+	jwk.Use = "sig"
+
+	return jwk, nil
+}
+
+// ParseJWK получает из опубликованного JWK ключ только для проверки подписи.
+// Алгоритм берётся из alg и должен подходить к типу ключа. Если kid не указан,
+// он вычисляется как JWK Thumbprint
+func ParseJWK(jwk JWK) (*SigningKey, error) {
+	method, err := ParseSigningMethod(jwk.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: jwk.Kid, Method: method}
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if jwk.Kty != "RSA" {
+			return nil, fmt.Errorf("ключ %s не подходит для %s", jwk.Kty, method.Alg())
+		}
+		n, errN := decodeSegment(jwk.N)
+		e, errE := decodeSegment(jwk.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("невалидный RSA ключ в JWK")
+		}
+		key.PublicKey = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	case *jwt.SigningMethodECDSA:
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		}
+		if jwk.Kty != "EC" || curve == nil || curve.Params().BitSize != m.CurveBits {
+			return nil, fmt.Errorf("кривая %s не подходит для %s", jwk.Crv, method.Alg())
+		}
+		x, errX := decodeSegment(jwk.X)
+		y, errY := decodeSegment(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("невалидный ECDSA ключ в JWK")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, errors.New("точка ECDSA ключа не лежит на кривой")
+		}
+		key.PublicKey = publicKey
+	case *jwt.SigningMethodEd25519:
+		x, err := decodeSegment(jwk.X)
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("невалидный Ed25519 ключ в JWK")
+		}
+		key.PublicKey = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("%w: %s не публикуется в JWKS", ErrUnsupportedSigningMethod, method.Alg())
+	}
+
+	if key.ID == "" {
+		if key.ID, err = thumbprint(key.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// publicJWK заполняет только параметры ключа, без kid/alg/use
+func publicJWK(publicKey interface{}) (JWK, error) {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   encodeSegment(pub.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   encodeSegment(pub.X.FillBytes(make([]byte, size))),
+			Y:   encodeSegment(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encodeSegment(pub),
+		}, nil
+	}
+
+	return JWK{}, fmt.Errorf("%w: ключ %T нельзя опубликовать в JWKS", ErrUnsupportedSigningMethod, publicKey)
+}
+
+// thumbprint вычисляет kid ключа как JWK Thumbprint (RFC 7638)
+func thumbprint(publicKey interface{}) (string, error) {
+	jwk, err := publicJWK(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Обязательные члены в лексикографическом порядке, без пробелов
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return encodeSegment(sum[:]), nil
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+// JWKS возвращает публичные ключи, которыми подписаны действующие токены:
+// активный ключ и ключи, ещё не выведенные из работы после ротации.
+// Симметричный секрет HS512 не публикуется
+func (tm *TokenManager) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range tm.keyring.Keys() {
+		if key.Symmetric() {
+			continue
+		}
+
+		jwk, err := NewJWK(key)
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
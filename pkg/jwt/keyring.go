@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("signing key not found")
+	ErrKeyNotUsable = errors.New("signing key cannot be used for signing")
+)
+
+// KeyInfo описывает состояние ключа в связке
+type KeyInfo struct {
+	ID        string     `json:"kid"`
+	Alg       string     `json:"alg"`
+	Active    bool       `json:"active"`
+	CanSign   bool       `json:"can_sign"`
+	RetiresAt *time.Time `json:"retires_at,omitempty"`
+}
+
+// Keyring - связка ключей подписи: один активный ключ, которым подписываются
+// новые токены, и ключи "только для проверки", которыми подписаны ещё живые токены.
+// Выведенный из работы ключ удаляется из связки после retireAt
+type Keyring struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*keyringEntry
+}
+
+type keyringEntry struct {
+	key      *SigningKey
+	retireAt time.Time // нулевое значение - ключ не выводится автоматически
+}
+
+func NewKeyring(active *SigningKey, verifyOnly ...*SigningKey) *Keyring {
+	kr := &Keyring{
+		active: active,
+		keys:   map[string]*keyringEntry{active.ID: {key: active}},
+	}
+
+	for _, key := range verifyOnly {
+		kr.Add(key)
+	}
+
+	return kr
+}
+
+// Active возвращает ключ, которым подписываются новые токены
+func (kr *Keyring) Active() *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.active
+}
+
+// Add добавляет ключ только для проверки подписи
+func (kr *Keyring) Add(key *SigningKey) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.keys[key.ID]; !ok {
+		kr.keys[key.ID] = &keyringEntry{key: key}
+	}
+}
+
+// AddUntil добавляет ключ только для проверки подписи, который выводится из работы после retireAt
+func (kr *Keyring) AddUntil(key *SigningKey, retireAt time.Time) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.keys[key.ID]; !ok {
+		kr.keys[key.ID] = &keyringEntry{key: key, retireAt: retireAt}
+	}
+}
+
+// Lookup ищет ключ для проверки подписи по kid.
+// Токены без kid выпущены до ротации ключей общим секретом HS512 и проверяются ключом HMACKeyID,
+// а не активным: после перехода на асимметричный ключ они остаются рабочими, пока секрет не выведен из работы.
+// Если секрета в связке нет, такие токены проверяются активным ключом
+func (kr *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if kid == "" {
+		if _, ok := kr.keys[HMACKeyID]; !ok {
+			return kr.active, true
+		}
+		kid = HMACKeyID
+	}
+
+	entry, ok := kr.keys[kid]
+	if !ok || entry.retired(time.Now()) {
+		return nil, false
+	}
+
+	return entry.key, true
+}
+
+// Promote делает ключ kid активным. Прежний активный ключ остаётся в связке
+// для проверки уже выпущенных токенов и выводится из работы через overlap
+func (kr *Keyring) Promote(kid string, overlap time.Duration) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	now := time.Now()
+	kr.prune(now)
+
+	entry, ok := kr.keys[kid]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if !entry.key.CanSign() {
+		return ErrKeyNotUsable
+	}
+	if entry.key == kr.active {
+		return nil
+	}
+
+	kr.keys[kr.active.ID].retireAt = now.Add(overlap)
+	entry.retireAt = time.Time{}
+	kr.active = entry.key
+
+	return nil
+}
+
+// Keys возвращает ключи, пригодные для проверки подписи, начиная с активного
+func (kr *Keyring) Keys() []*SigningKey {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kr.prune(time.Now())
+
+	keys := make([]*SigningKey, 0, len(kr.keys))
+	keys = append(keys, kr.active)
+	for _, entry := range kr.keys {
+		if entry.key != kr.active {
+			keys = append(keys, entry.key)
+		}
+	}
+	sort.SliceStable(keys[1:], func(i, j int) bool { return keys[i+1].ID < keys[j+1].ID })
+
+	return keys
+}
+
+// Info возвращает состояние всех ключей связки
+func (kr *Keyring) Info() []KeyInfo {
+	keys := kr.Keys()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	info := make([]KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		item := KeyInfo{
+			ID:      key.ID,
+			Alg:     key.Method.Alg(),
+			Active:  key == kr.active,
+			CanSign: key.CanSign(),
+		}
+		if entry, ok := kr.keys[key.ID]; ok && !entry.retireAt.IsZero() {
+			retireAt := entry.retireAt
+			item.RetiresAt = &retireAt
+		}
+		info = append(info, item)
+	}
+
+	return info
+}
+
+// prune удаляет из связки ключи, срок перекрытия которых истёк
+func (kr *Keyring) prune(now time.Time) {
+	for kid, entry := range kr.keys {
+		if entry.key != kr.active && entry.retired(now) {
+			delete(kr.keys, kid)
+		}
+	}
+}
+
+func (e *keyringEntry) retired(now time.Time) bool {
+	return !e.retireAt.IsZero() && now.After(e.retireAt)
+}
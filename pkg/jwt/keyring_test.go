@@ -0,0 +1,229 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestKeyringLookup(t *testing.T) {
+	active := newTestECKey(t)
+	verifyOnly := newTestECKey(t)
+	hmacKey := NewHMACKey("secret")
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		kid     string
+		want    *SigningKey
+	}{
+		{
+			name:    "активный ключ по kid",
+			keyring: NewKeyring(active, verifyOnly),
+			kid:     active.ID,
+			want:    active,
+		},
+		{
+			name:    "ключ только для проверки по kid",
+			keyring: NewKeyring(active, verifyOnly),
+			kid:     verifyOnly.ID,
+			want:    verifyOnly,
+		},
+		{
+			name:    "секрет HS512 по kid",
+			keyring: NewKeyring(active, hmacKey),
+			kid:     HMACKeyID,
+			want:    hmacKey,
+		},
+		{
+			name:    "токен без kid проверяется секретом HS512, а не активным ключом",
+			keyring: NewKeyring(active, hmacKey),
+			want:    hmacKey,
+		},
+		{
+			name:    "токен без kid без секрета в связке проверяется активным ключом",
+			keyring: NewKeyring(active, verifyOnly),
+			want:    active,
+		},
+		{
+			name:    "неизвестный kid",
+			keyring: NewKeyring(active, hmacKey),
+			kid:     "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.keyring.Lookup(tt.kid)
+			if ok != (tt.want != nil) || got != tt.want {
+				t.Fatalf("Lookup(%q) = %v, %v, want %v", tt.kid, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringPromote(t *testing.T) {
+	previous := newTestECKey(t)
+	next := newTestECKey(t)
+	publicOnly := &SigningKey{ID: "public", Method: jwt.SigningMethodES256, PublicKey: next.PublicKey}
+
+	kr := NewKeyring(previous, next, publicOnly)
+
+	if err := kr.Promote("unknown", time.Hour); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Promote(unknown) error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if err := kr.Promote(publicOnly.ID, time.Hour); !errors.Is(err, ErrKeyNotUsable) {
+		t.Fatalf("Promote(public) error = %v, want %v", err, ErrKeyNotUsable)
+	}
+
+	if err := kr.Promote(next.ID, time.Hour); err != nil {
+		t.Fatalf("Promote() error = %v", err)
+	}
+	if kr.Active() != next {
+		t.Fatalf("Active() = %s, want %s", kr.Active().ID, next.ID)
+	}
+	if _, ok := kr.Lookup(previous.ID); !ok {
+		t.Fatal("прежний активный ключ должен проверять токены в период перекрытия")
+	}
+
+	info := kr.Info()
+	if info[0].ID != next.ID || !info[0].Active {
+		t.Fatalf("Info()[0] = %+v, want активный %s", info[0], next.ID)
+	}
+	for _, item := range info {
+		if item.ID == previous.ID && item.RetiresAt == nil {
+			t.Fatal("у прежнего активного ключа должен быть срок вывода из работы")
+		}
+	}
+}
+
+func TestKeyringRetiredKeyIsPruned(t *testing.T) {
+	hmacKey := NewHMACKey("secret")
+	ecKey := newTestECKey(t)
+
+	kr := NewKeyring(hmacKey, ecKey)
+	if err := kr.Promote(ecKey.ID, -time.Second); err != nil {
+		t.Fatalf("Promote() error = %v", err)
+	}
+
+	if _, ok := kr.Lookup(HMACKeyID); ok {
+		t.Fatal("выведенный из работы ключ не должен находиться по kid")
+	}
+	if got, ok := kr.Lookup(""); ok && got == hmacKey {
+		t.Fatal("токены без kid не должны проверяться выведенным из работы секретом")
+	}
+	if keys := kr.Keys(); len(keys) != 1 || keys[0] != ecKey {
+		t.Fatalf("Keys() = %d ключей, want только активный", len(keys))
+	}
+}
+
+func TestLegacySecretRetiresAfterWindow(t *testing.T) {
+	hmacKey := NewHMACKey("secret")
+	ecKey := newTestECKey(t)
+
+	// Токен выпущен общим секретом до появления kid
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS512, TokenClaims{
+		UserID:           uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString(hmacKey.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		retireAt time.Time
+		wantErr  error
+	}{
+		{name: "в пределах окна", retireAt: time.Now().Add(time.Hour)},
+		{name: "после окна", retireAt: time.Now().Add(-time.Second), wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := NewKeyring(ecKey)
+			kr.AddUntil(hmacKey, tt.retireAt)
+			tm := NewTokenManager(kr, Options{})
+
+			if _, err := tm.ParseAccessToken(legacy); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseAccessToken() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// После удаления секрета из связки токен без kid не проверяется и активным ключом
+			kr.Keys()
+			if _, err := tm.ParseAccessToken(legacy); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseAccessToken() после очистки связки error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKSSkipsSymmetricKeys(t *testing.T) {
+	ecKey := newTestECKey(t)
+	tm := NewTokenManager(NewKeyring(NewHMACKey("secret"), ecKey), Options{})
+
+	jwks := tm.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("JWKS() = %d ключей, want 1", len(jwks.Keys))
+	}
+
+	jwk := jwks.Keys[0]
+	if jwk.Kid != ecKey.ID || jwk.Alg != "ES256" || jwk.Kty != "EC" || jwk.Use != "sig" {
+		t.Fatalf("JWKS()[0] = %+v", jwk)
+	}
+
+	parsed, err := ParseJWK(jwk)
+	if err != nil {
+		t.Fatalf("ParseJWK() error = %v", err)
+	}
+	if parsed.ID != ecKey.ID || parsed.CanSign() {
+		t.Fatalf("ParseJWK() = kid %s, can sign %v", parsed.ID, parsed.CanSign())
+	}
+	if !ecKey.PublicKey.(*ecdsa.PublicKey).Equal(parsed.PublicKey) {
+		t.Fatal("ParseJWK() вернул другой публичный ключ")
+	}
+}
+
+func TestAlgorithmMismatchIsRejected(t *testing.T) {
+	hmacKey := NewHMACKey("secret")
+	ecKey := newTestECKey(t)
+
+	// Токен HS512 с kid асимметричного ключа не должен проверяться его публичной частью
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, TokenClaims{
+		UserID:           uuid.New(),
+		TokenUse:         TokenUseAccess,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	token.Header["kid"] = ecKey.ID
+	signed, err := token.SignedString(hmacKey.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenManager(NewKeyring(ecKey, hmacKey), Options{})
+	if _, err = tm.ParseAccessToken(signed); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseAccessToken() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func newTestECKey(t *testing.T) *SigningKey {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &SigningKey{Method: jwt.SigningMethodES256, PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}
+	if key.ID, err = thumbprint(key.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
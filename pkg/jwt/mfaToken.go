@@ -0,0 +1,34 @@
+package jwt
+
+import (
+	"strings"
+	"time"
+)
+
+// GenerateMFAToken выпускает токен MFA challenge: короткоживущее подтверждение того,
+// что первый фактор пройден. Токен несёт запрошенные scopes и методы аутентификации,
+// чтобы после проверки второго фактора выдать пару с теми же правами
+func (tm *TokenManager) GenerateMFAToken(grant Grant, ttl time.Duration) (string, error) {
+	claims := TokenClaims{
+		UserID:           grant.UserID,
+		TokenUse:         TokenUseMFA,
+		Scope:            strings.Join(grant.Scopes, " "),
+		AMR:              grant.AMR,
+		RegisteredClaims: tm.registeredClaims(grant.UserID.String(), ttl),
+	}
+
+	return tm.sign(claims, "JWT")
+}
+
+// ParseMFAToken разбирает токен MFA challenge, выпущенный этим сервисом
+func (tm *TokenManager) ParseMFAToken(mfaToken string) (*TokenClaims, error) {
+	claims, err := parseToken(tm.keyring, mfaToken, tm.leeway)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != TokenUseMFA {
+		return nil, ErrNotMFAToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,58 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Форматы refresh токенов
+const (
+	RefreshFormatJWT    = "jwt"    // подписанный JWT с RefreshID
+	RefreshFormatOpaque = "opaque" // случайная строка без структуры
+)
+
+const opaqueSecretSize = 32 // 256 бит случайности
+
+// opaqueTokenLength - длина непрозрачного токена: ID сессии и секрет в base64url без выравнивания
+var opaqueTokenLength = base64.RawURLEncoding.EncodedLen(len(uuid.UUID{}) + opaqueSecretSize)
+
+// generateOpaqueRefreshToken кодирует в токен ID сессии и 256-битный случайный секрет.
+// Сам токен ничего не подписывает: подлинность проверяется сравнением с хешем из сессии
+func generateOpaqueRefreshToken(refreshID string) (string, error) {
+	id, err := uuid.Parse(refreshID)
+	if err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, len(id)+opaqueSecretSize)
+	copy(raw, id[:])
+	if _, err = rand.Read(raw[len(id):]); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// parseOpaqueRefreshToken извлекает ID сессии из непрозрачного токена без разбора JWT
+func parseOpaqueRefreshToken(refreshToken string) (*TokenClaims, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(refreshToken)
+	if err != nil || len(raw) != len(uuid.UUID{})+opaqueSecretSize {
+		return nil, ErrInvalidToken
+	}
+
+	id, err := uuid.FromBytes(raw[:len(uuid.UUID{})])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &TokenClaims{RefreshID: id.String()}, nil
+}
+
+// isOpaqueToken отличает непрозрачный токен от JWT, в котором всегда есть точки.
+// Строка другой длины не считается непрозрачным токеном и разбирается как JWT
+func isOpaqueToken(token string) bool {
+	return len(token) == opaqueTokenLength && !strings.Contains(token, ".")
+}
@@ -0,0 +1,73 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Префикс версии схемы хеширования в token_hash.
+// Хеши без префикса - устаревший xxhash, они проверяются, но больше не создаются:
+// при следующем обновлении токенов сессия-преемник получает хеш новой схемы
+const hashPrefixHMAC = "v2$"
+
+var ErrTokenHashMismatch = errors.New("refresh token does not match stored hash")
+
+// HashRefreshToken вычисляет HMAC-SHA256 refresh токена с серверным секретом (pepper)
+func (tm *TokenManager) HashRefreshToken(refreshToken string) (string, error) {
+	return hashPrefixHMAC + hex.EncodeToString(tm.hmacRefreshToken(refreshToken)), nil
+}
+
+// CompareRefreshToken сверяет токен с сохранённым хешем за постоянное время
+func (tm *TokenManager) CompareRefreshToken(hash, refreshToken string) error {
+	if encoded, ok := strings.CutPrefix(hash, hashPrefixHMAC); ok {
+		stored, err := hex.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("невалидный формат сохраненного хеша: %w", err)
+		}
+		if !hmac.Equal(stored, tm.hmacRefreshToken(refreshToken)) {
+			return ErrTokenHashMismatch
+		}
+		return nil
+	}
+
+	return compareLegacyHash(hash, refreshToken)
+}
+
+func (tm *TokenManager) hmacRefreshToken(refreshToken string) []byte {
+	mac := hmac.New(sha256.New, tm.pepper)
+	mac.Write([]byte(refreshToken))
+	return mac.Sum(nil)
+}
+
+// compareLegacyHash проверяет хеш xxhash, сохранённый до перехода на HMAC
+func compareLegacyHash(hash, refreshToken string) error {
+	storedHashValue, err := parseStoredHash(hash)
+	if err != nil {
+		return fmt.Errorf("невалидный формат сохраненного хеша: %w", err)
+	}
+
+	stored := binary.BigEndian.AppendUint64(nil, storedHashValue)
+	computed := binary.BigEndian.AppendUint64(nil, xxhash.Sum64String(refreshToken))
+	if subtle.ConstantTimeCompare(stored, computed) != 1 {
+		return ErrTokenHashMismatch
+	}
+
+	return nil
+}
+
+func parseStoredHash(storedHash string) (uint64, error) {
+	var hashValue uint64
+	_, err := fmt.Sscanf(storedHash, "%x", &hashValue)
+	if err != nil {
+		return 0, err
+	}
+	return hashValue, nil
+}
@@ -0,0 +1,54 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestCompareRefreshToken(t *testing.T) {
+	tm := NewTokenManager(NewKeyring(NewHMACKey("secret")), Options{Pepper: "pepper"})
+	otherPepper := NewTokenManager(NewKeyring(NewHMACKey("secret")), Options{Pepper: "other"})
+
+	const token = "refresh-token"
+	hash, err := tm.HashRefreshToken(token)
+	if err != nil {
+		t.Fatalf("HashRefreshToken() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, hashPrefixHMAC) {
+		t.Fatalf("HashRefreshToken() = %s, want префикс %s", hash, hashPrefixHMAC)
+	}
+
+	legacyHash := fmt.Sprintf("%x", xxhash.Sum64String(token))
+
+	tests := []struct {
+		name    string
+		tm      *TokenManager
+		hash    string
+		token   string
+		wantErr error
+	}{
+		{name: "совпадает", tm: tm, hash: hash, token: token},
+		{name: "другой токен", tm: tm, hash: hash, token: token + "x", wantErr: ErrTokenHashMismatch},
+		{name: "другой pepper", tm: otherPepper, hash: hash, token: token, wantErr: ErrTokenHashMismatch},
+		{name: "устаревший xxhash", tm: tm, hash: legacyHash, token: token},
+		{name: "устаревший xxhash, другой токен", tm: tm, hash: legacyHash, token: token + "x", wantErr: ErrTokenHashMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tm.CompareRefreshToken(tt.hash, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CompareRefreshToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, malformed := range []string{hashPrefixHMAC + "zz", "not-a-hash"} {
+		if err := tm.CompareRefreshToken(malformed, token); err == nil || errors.Is(err, ErrTokenHashMismatch) {
+			t.Fatalf("CompareRefreshToken(%q) error = %v, want ошибку формата", malformed, err)
+		}
+	}
+}
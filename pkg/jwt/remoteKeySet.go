@@ -0,0 +1,237 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RemoteKeySetOptions - параметры загрузки JWKS
+type RemoteKeySetOptions struct {
+	// RefreshInterval - период фонового обновления, по умолчанию 15 минут
+	RefreshInterval time.Duration
+	// MinRefreshInterval - не чаще этого набор перезагружается при встрече неизвестного kid
+	// (новый ключ после ротации), по умолчанию 30 секунд
+	MinRefreshInterval time.Duration
+	// LookupTimeout - сколько проверка токена с неизвестным kid ждёт перезагрузки набора,
+	// по умолчанию 2 секунды. Загрузка при этом не прерывается, и её результат получат следующие запросы
+	LookupTimeout time.Duration
+	// HTTPClient, по умолчанию клиент с таймаутом 5 секунд
+	HTTPClient *http.Client
+}
+
+// remoteFetchTimeout ограничивает загрузку JWKS, если у HTTPClient нет своего таймаута
+const remoteFetchTimeout = 30 * time.Second
+
+// RemoteKeySet - набор ключей проверки подписи, загружаемый по JWKS URL
+// (/.well-known/jwks.json). Ключи кешируются в памяти и обновляются в фоне,
+// а при неизвестном kid набор перезагружается сразу, но не чаще MinRefreshInterval.
+// Одновременные перезагрузки объединяются в одну
+type RemoteKeySet struct {
+	url             string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	minInterval     time.Duration
+	lookupTimeout   time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*SigningKey
+	inflight    *keyFetch // идущая загрузка, к которой присоединяются остальные
+	lastAttempt time.Time
+}
+
+// keyFetch - одна загрузка JWKS, done закрывается по её завершении
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewRemoteKeySet(url string, opts RemoteKeySetOptions) *RemoteKeySet {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 15 * time.Minute
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = 30 * time.Second
+	}
+	if opts.LookupTimeout <= 0 {
+		opts.LookupTimeout = 2 * time.Second
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	return &RemoteKeySet{
+		url:             url,
+		httpClient:      opts.HTTPClient,
+		refreshInterval: opts.RefreshInterval,
+		minInterval:     opts.MinRefreshInterval,
+		lookupTimeout:   opts.LookupTimeout,
+		keys:            map[string]*SigningKey{},
+	}
+}
+
+// Start загружает набор ключей и обновляет его в фоне, пока не отменён ctx.
+// Ошибка первой загрузки возвращается, но фоновое обновление всё равно запускается
+func (s *RemoteKeySet) Start(ctx context.Context) error {
+	err := s.Refresh(ctx)
+
+	go func() {
+		ticker := time.NewTicker(s.refreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = s.Refresh(ctx)
+			}
+		}
+	}()
+
+	return err
+}
+
+// Refresh загружает JWKS и заменяет им закешированный набор, а если загрузка уже идёт - дожидается её.
+// При ошибке прежний набор остаётся в силе. Отмена ctx прекращает ожидание, но не саму загрузку
+func (s *RemoteKeySet) Refresh(ctx context.Context) error {
+	f := s.startFetch(true)
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Lookup ищет ключ по kid. Токены без kid не принимаются: их подписывает
+// общий секрет HS512, который не публикуется в JWKS.
+// Неизвестный kid перезагружает набор, но ждать загрузку дольше LookupTimeout Lookup не будет
+func (s *RemoteKeySet) Lookup(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		return nil, false
+	}
+
+	if key, ok := s.lookup(kid); ok {
+		return key, true
+	}
+
+	f := s.startFetch(false)
+	if f == nil {
+		return nil, false
+	}
+
+	timer := time.NewTimer(s.lookupTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, false
+		}
+		return s.lookup(kid)
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+func (s *RemoteKeySet) lookup(kid string) (*SigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// startFetch возвращает идущую загрузку JWKS или запускает новую в фоне. Без force новая загрузка
+// не запускается чаще MinRefreshInterval, тогда startFetch возвращает nil
+func (s *RemoteKeySet) startFetch(force bool) *keyFetch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inflight != nil {
+		return s.inflight
+	}
+	if !force && time.Since(s.lastAttempt) < s.minInterval {
+		return nil
+	}
+
+	f := &keyFetch{done: make(chan struct{})}
+	s.inflight = f
+	s.lastAttempt = time.Now()
+
+	go func() {
+		// Загрузка общая для всех ожидающих, поэтому не зависит от контекста того, кто её запустил
+		ctx, cancel := context.WithTimeout(context.Background(), remoteFetchTimeout)
+		defer cancel()
+
+		f.err = s.refresh(ctx)
+
+		s.mu.Lock()
+		s.inflight = nil
+		s.mu.Unlock()
+		close(f.done)
+	}()
+
+	return f
+}
+
+func (s *RemoteKeySet) refresh(ctx context.Context) error {
+	const op = "jwt.RemoteKeySet.refresh"
+
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		slog.Error(op, "не удалось загрузить JWKS", slog.String("url", s.url), slog.String("error", err.Error()))
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *RemoteKeySet) fetch(ctx context.Context) (map[string]*SigningKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("статус ответа %d", resp.StatusCode)
+	}
+
+	var jwks JWKS
+	if err = json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("невалидный JWKS: %w", err)
+	}
+
+	keys := make(map[string]*SigningKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := ParseJWK(jwk)
+		if err != nil {
+			// Ключ неподдерживаемого типа не должен ломать проверку остальных
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,62 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoteKeySetSharesRefetch(t *testing.T) {
+	key := newTestECKey(t)
+	jwks := NewTokenManager(NewKeyring(key), Options{}).JWKS()
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	defer server.Close()
+
+	keySet := NewRemoteKeySet(server.URL, RemoteKeySetOptions{LookupTimeout: 50 * time.Millisecond})
+
+	// Пока JWKS не отвечает, проверка не ждёт дольше LookupTimeout
+	started := time.Now()
+	if _, ok := keySet.Lookup(key.ID); ok {
+		t.Fatal("ключ найден до загрузки набора")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("Lookup() ждал загрузку %s", elapsed)
+	}
+
+	// Остальные запросы с тем же kid присоединяются к идущей загрузке
+	keySet.lookupTimeout = 5 * time.Second
+	var wg sync.WaitGroup
+	found := make(chan bool, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok := keySet.Lookup(key.ID)
+			found <- ok
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(found)
+
+	for ok := range found {
+		if !ok {
+			t.Fatal("Lookup() не нашёл ключ после загрузки набора")
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("JWKS загружен %d раз, want 1", n)
+	}
+}
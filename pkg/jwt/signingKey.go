@@ -0,0 +1,162 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnsupportedSigningMethod = errors.New("unsupported signing method")
+
+// HMACKeyID - kid ключа HS512 из общего секрета. Токены без kid выпущены этим ключом
+// до появления ротации и проверяются им, даже если активным стал асимметричный ключ
+const HMACKeyID = "hs512"
+
+// SigningKey - ключ, которым TokenManager подписывает и проверяет токены.
+// Для HMAC PrivateKey и PublicKey содержат один и тот же секрет ([]byte),
+// для асимметричных алгоритмов - соответствующие половины пары ключей.
+type SigningKey struct {
+	ID         string // kid: HMACKeyID для HS512, для асимметричных ключей - JWK Thumbprint
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+// NewHMACKey создаёт симметричный ключ HS512 из общего секрета
+func NewHMACKey(secret string) *SigningKey {
+	return &SigningKey{
+		ID:         HMACKeyID,
+		Method:     jwt.SigningMethodHS512,
+		PrivateKey: []byte(secret),
+		PublicKey:  []byte(secret),
+	}
+}
+
+// LoadSigningKey читает ключ в формате PEM из файла
+func LoadSigningKey(method, path string) (*SigningKey, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать ключ %s: %w", path, err)
+	}
+
+	return ParseSigningKey(method, pemBytes)
+}
+
+// ParseSigningKey разбирает ключ в формате PEM и проверяет, что он подходит
+// для выбранного алгоритма (RS*, PS*, ES*, EdDSA). Из публичного ключа получается
+// ключ только для проверки подписи: им нельзя подписывать и его нельзя сделать активным
+func ParseSigningKey(method string, pemBytes []byte) (*SigningKey, error) {
+	signingMethod, err := ParseSigningMethod(method)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("ключ не в формате PEM")
+	}
+	publicOnly := strings.HasSuffix(block.Type, "PUBLIC KEY")
+
+	key := &SigningKey{Method: signingMethod}
+
+	switch m := signingMethod.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if publicOnly {
+			key.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		} else {
+			var privateKey *rsa.PrivateKey
+			if privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+				key.PrivateKey, key.PublicKey = privateKey, &privateKey.PublicKey
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("невалидный RSA ключ: %w", err)
+		}
+	case *jwt.SigningMethodECDSA:
+		var publicKey *ecdsa.PublicKey
+		if publicOnly {
+			publicKey, err = jwt.ParseECPublicKeyFromPEM(pemBytes)
+		} else {
+			var privateKey *ecdsa.PrivateKey
+			if privateKey, err = jwt.ParseECPrivateKeyFromPEM(pemBytes); err == nil {
+				key.PrivateKey, publicKey = privateKey, &privateKey.PublicKey
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("невалидный ECDSA ключ: %w", err)
+		}
+		if publicKey.Curve.Params().BitSize != m.CurveBits {
+			return nil, fmt.Errorf("кривая %s не подходит для %s", publicKey.Curve.Params().Name, m.Alg())
+		}
+		key.PublicKey = publicKey
+	case *jwt.SigningMethodEd25519:
+		if publicOnly {
+			key.PublicKey, err = jwt.ParseEdPublicKeyFromPEM(pemBytes)
+		} else {
+			var privateKey crypto.PrivateKey
+			if privateKey, err = jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+				edKey := privateKey.(ed25519.PrivateKey)
+				key.PrivateKey, key.PublicKey = edKey, edKey.Public()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("невалидный Ed25519 ключ: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s не использует пару ключей", ErrUnsupportedSigningMethod, method)
+	}
+
+	if key.ID, err = thumbprint(key.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Symmetric сообщает, что ключ - общий секрет, который нельзя публиковать
+func (k *SigningKey) Symmetric() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// CanSign сообщает, есть ли у ключа приватная часть
+func (k *SigningKey) CanSign() bool {
+	return k.PrivateKey != nil
+}
+
+// ParseSigningMethod возвращает алгоритм подписи по имени из конфигурации.
+// SHA512 оставлен как синоним HS512 для совместимости со старыми .env файлами
+func ParseSigningMethod(name string) (jwt.SigningMethod, error) {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, "SHA512") {
+		return jwt.SigningMethodHS512, nil
+	}
+
+	switch name {
+	case "HS512",
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA":
+		return jwt.GetSigningMethod(name), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedSigningMethod, name)
+}
+
+// verifyKey возвращает ключ для проверки подписи, если алгоритм токена совпадает с алгоритмом ключа
+func (k *SigningKey) verifyKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+
+	return k.PublicKey, nil
+}
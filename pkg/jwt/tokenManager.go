@@ -2,22 +2,63 @@ package jwt
 
 import (
 	"errors"
-	"fmt"
-	"github.com/cespare/xxhash/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"slices"
+	"strings"
 	"time"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrTokenExpired = errors.New("token expired")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenExpired    = errors.New("token expired")
+	ErrNotAccessToken  = errors.New("token is not an access token")
+	ErrNotRefreshToken = errors.New("token is not a refresh token")
+	ErrNotMFAToken     = errors.New("token is not an MFA challenge token")
+)
+
+// Значения claim token_use
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	TokenUseMFA     = "mfa" // токен MFA challenge: пароль проверен, ожидается второй фактор
+)
+
+// Значения claim amr - методы аутентификации (RFC 8176)
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRMultiFactor = "mfa"
+	AMRHardwareKey = "hwk"   // ключ доступа (passkey) WebAuthn
+	AMREmail       = "email" // ссылка или код из письма, вне RFC 8176
 )
 
 type TokenManager struct {
-	secretKey  string
-	accessTTL  time.Duration
-	refreshTTL time.Duration
+	keyring       *Keyring
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	pepper        []byte
+	refreshFormat string
+	issuer        string
+	audience      string
+	leeway        time.Duration
+
+	accessVerifier *AccessTokenVerifier
+}
+
+// Options - параметры выпуска токенов
+type Options struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Pepper     string // серверный секрет для HMAC хеша refresh токенов
+
+	// Формат выпускаемых refresh токенов: RefreshFormatJWT (по умолчанию) или RefreshFormatOpaque.
+	// Разбираются токены обоих форматов, поэтому режим можно сменить без разлогина пользователей
+	RefreshFormat string
+
+	Issuer   string        // iss, проверяется в access токенах, если задан. Токены без iss принимаются ещё AccessTTL после запуска
+	Audience string        // aud, проверяется в access токенах, если задан. Токены без aud принимаются ещё AccessTTL после запуска
+	Leeway   time.Duration // допустимое расхождение часов при проверке exp, nbf и iat
 }
 
 type TokenPair struct {
@@ -29,21 +70,79 @@ type TokenClaims struct {
 	UserID    uuid.UUID
 	UserIP    string
 	RefreshID string
+	TokenUse  string                 `json:"token_use,omitempty"` // access или refresh
+	Scope     string                 `json:"scope,omitempty"`     // выданные scopes через пробел (RFC 8693)
+	Roles     []string               `json:"roles,omitempty"`
+	AMR       []string               `json:"amr,omitempty"`       // методы аутентификации при входе
+	AuthTime  *jwt.NumericDate       `json:"auth_time,omitempty"` // время входа, сохраняется при обновлении токенов
+	ClientID  string                 `json:"client_id,omitempty"` // OAuth клиент, которому выдан токен (RFC 9068)
+	Custom    map[string]interface{} `json:"ext,omitempty"`       // дополнительные claims от ClaimsProvider
 	jwt.RegisteredClaims
 }
 
-func NewTokenManager(secretKey string, accessTTL, refreshTTL time.Duration) *TokenManager {
+// Grant описывает, кому и с какими правами выпускается пара токенов
+type Grant struct {
+	UserID   uuid.UUID
+	UserIP   string
+	Scopes   []string
+	Roles    []string
+	AMR      []string
+	AuthTime time.Time // время входа, нулевое - claim auth_time не выпускается
+	ClientID string    // OAuth клиент, пусто для собственных приложений сервиса
+	Custom   map[string]interface{}
+}
+
+// Scopes возвращает выданные scopes списком
+func (c *TokenClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope сообщает, выдан ли токену scope
+func (c *TokenClaims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// HasAMR сообщает, использовался ли при входе метод аутентификации, например AMRMultiFactor
+func (c *TokenClaims) HasAMR(method string) bool {
+	return slices.Contains(c.AMR, method)
+}
+
+// AuthenticatedWithin сообщает, что пользователь входил не раньше maxAge назад. Токен без
+// auth_time считается выпущенным давно: подтвердить свежесть входа он не может
+func (c *TokenClaims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= maxAge
+}
+
+// HasRole сообщает, есть ли у пользователя роль
+func (c *TokenClaims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+func NewTokenManager(keyring *Keyring, opts Options) *TokenManager {
 	return &TokenManager{
-		secretKey:  secretKey,
-		accessTTL:  accessTTL,
-		refreshTTL: refreshTTL,
+		keyring:       keyring,
+		accessTTL:     opts.AccessTTL,
+		refreshTTL:    opts.RefreshTTL,
+		pepper:        []byte(opts.Pepper),
+		refreshFormat: opts.RefreshFormat,
+		issuer:        opts.Issuer,
+		audience:      opts.Audience,
+		leeway:        opts.Leeway,
+
+		// Access токены без iss и aud, выпущенные до их появления, живут не дольше AccessTTL после запуска
+		accessVerifier: NewAccessTokenVerifier(keyring, VerifierOptions{
+			Issuer:      opts.Issuer,
+			Audience:    opts.Audience,
+			Leeway:      opts.Leeway,
+			LegacyUntil: time.Now().Add(opts.AccessTTL + opts.Leeway),
+		}),
 	}
 }
 
-func (tm *TokenManager) GenerateTokenPair(userID uuid.UUID, userIP string) (TokenPair, string, error) {
+func (tm *TokenManager) GenerateTokenPair(grant Grant) (TokenPair, string, error) {
 	refreshID := uuid.NewString()
 
-	accessToken, err := tm.generateAccessToken(userID, userIP, refreshID)
+	accessToken, err := tm.generateAccessToken(grant, refreshID)
 	if err != nil {
 		return TokenPair{}, "", err
 	}
@@ -59,103 +158,115 @@ func (tm *TokenManager) GenerateTokenPair(userID uuid.UUID, userIP string) (Toke
 	}, refreshID, nil
 }
 
-func (tm *TokenManager) generateAccessToken(userID uuid.UUID, userIP, refreshID string) (string, error) {
+func (tm *TokenManager) generateAccessToken(grant Grant, refreshID string) (string, error) {
 	claims := TokenClaims{
-		UserID:    userID,
-		UserIP:    userIP,
-		RefreshID: refreshID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tm.accessTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		UserID:           grant.UserID,
+		UserIP:           grant.UserIP,
+		RefreshID:        refreshID,
+		TokenUse:         TokenUseAccess,
+		Scope:            strings.Join(grant.Scopes, " "),
+		Roles:            grant.Roles,
+		AMR:              grant.AMR,
+		ClientID:         grant.ClientID,
+		Custom:           grant.Custom,
+		RegisteredClaims: tm.registeredClaims(grant.UserID.String(), tm.accessTTL),
+	}
+	if !grant.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(grant.AuthTime)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	return token.SignedString([]byte(tm.secretKey))
+	return tm.sign(claims, "at+jwt")
 }
 
 func (tm *TokenManager) generateRefreshToken(refreshID string) (string, error) {
-	claims := TokenClaims{
-		RefreshID: refreshID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tm.refreshTTL)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	if tm.refreshFormat == RefreshFormatOpaque {
+		return generateOpaqueRefreshToken(refreshID)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	return token.SignedString([]byte(tm.secretKey))
-}
-
-func (tm *TokenManager) ParseAccessToken(accessToken string) (*TokenClaims, error) {
-	return tm.parseTokens(accessToken)
-}
+	claims := TokenClaims{
+		RefreshID:        refreshID,
+		TokenUse:         TokenUseRefresh,
+		RegisteredClaims: tm.registeredClaims("", tm.refreshTTL),
+	}
 
-func (tm *TokenManager) ParseRefreshToken(refreshToken string) (*TokenClaims, error) {
-	return tm.parseTokens(refreshToken)
+	return tm.sign(claims, "JWT")
 }
 
-func (tm *TokenManager) parseTokens(tokenString string) (*TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if token.Method != jwt.SigningMethodHS512 {
-			return nil, ErrInvalidToken
-		}
-		return []byte(tm.secretKey), nil
-	})
+// registeredClaims заполняет стандартные claims RFC 7519: sub, iss, aud, jti, iat, nbf и exp
+func (tm *TokenManager) registeredClaims(subject string, ttl time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
 
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrTokenExpired
-		}
-		return nil, ErrInvalidToken
+	claims := jwt.RegisteredClaims{
+		Subject:   subject,
+		Issuer:    tm.issuer,
+		ID:        uuid.NewString(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 	}
-
-	claims, ok := token.Claims.(*TokenClaims)
-	if !ok || !token.Valid {
-		return nil, ErrInvalidToken
+	if tm.audience != "" {
+		claims.Audience = jwt.ClaimStrings{tm.audience}
 	}
 
-	return claims, nil
+	return claims
 }
 
-func (tm *TokenManager) HashRefreshToken(refreshToken string) (string, error) {
-	tokenBytes := []byte(refreshToken)
+// sign подписывает claims активным ключом и указывает в заголовке его kid и тип токена typ
+func (tm *TokenManager) sign(claims TokenClaims, typ string) (string, error) {
+	key := tm.keyring.Active()
 
-	hasher := xxhash.New()
-	_, err := hasher.Write(tokenBytes)
-	if err != nil {
-		return "", err
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["typ"] = typ
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
 	}
+	return token.SignedString(key.PrivateKey)
+}
 
-	hash := hasher.Sum64()
-
-	return fmt.Sprintf("%x", hash), nil
+func (tm *TokenManager) ParseAccessToken(accessToken string) (*TokenClaims, error) {
+	return tm.accessVerifier.ParseAccessToken(accessToken)
 }
 
-func (tm *TokenManager) CompareRefreshToken(hash, refreshToken string) error {
-	h := xxhash.New()
-	h.Write([]byte(refreshToken))
-	computedHash := h.Sum64()
+// ParseRefreshToken разбирает refresh токен любого формата. Срок действия
+// непрозрачного токена не закодирован в нём и проверяется по сессии.
+// iss и aud не проверяются: refresh токен принимает только этот сервис и сверяет его с сессией,
+// а токены, выпущенные до появления этих claims, должны оставаться рабочими
+func (tm *TokenManager) ParseRefreshToken(refreshToken string) (*TokenClaims, error) {
+	if isOpaqueToken(refreshToken) {
+		return parseOpaqueRefreshToken(refreshToken)
+	}
 
-	storedHashValue, err := parseStoredHash(hash)
+	claims, err := parseToken(tm.keyring, refreshToken, tm.leeway)
 	if err != nil {
-		return fmt.Errorf("невалидный формат сохраненного хеша: %w", err)
+		return nil, err
 	}
-
-	if storedHashValue != computedHash {
-		return fmt.Errorf("токен не соответствует сохраненному хешу")
+	if !claims.isTokenUse(TokenUseRefresh) {
+		return nil, ErrNotRefreshToken
 	}
 
-	return nil
+	return claims, nil
 }
 
-func parseStoredHash(storedHash string) (uint64, error) {
-	var hashValue uint64
-	_, err := fmt.Sscanf(storedHash, "%x", &hashValue)
-	if err != nil {
-		return 0, err
+// isTokenUse проверяет тип токена. У токенов, выпущенных до появления token_use,
+// тип определяется по UserID: он есть только в access токене
+func (c *TokenClaims) isTokenUse(use string) bool {
+	if c.TokenUse != "" {
+		return c.TokenUse == use
 	}
-	return hashValue, nil
+
+	isAccess := c.UserID != uuid.Nil
+	return isAccess == (use == TokenUseAccess)
+}
+
+// RotateKey делает ключ kid активным. Прежний ключ продолжает проверять
+// выпущенные им токены, пока не истечёт самый долгий из TTL
+func (tm *TokenManager) RotateKey(kid string) error {
+	return tm.keyring.Promote(kid, max(tm.accessTTL, tm.refreshTTL))
+}
+
+// Keys возвращает состояние ключей подписи
+func (tm *TokenManager) Keys() []KeyInfo {
+	return tm.keyring.Info()
 }
 
 func (tm *TokenManager) GetAccessTTL() time.Duration {
@@ -0,0 +1,307 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestAccessTokenVerifier(t *testing.T) {
+	ecKey := newTestECKey(t)
+	opts := Options{AccessTTL: time.Minute, RefreshTTL: time.Hour, Issuer: "https://auth.example.com", Audience: "api"}
+	tm := NewTokenManager(NewKeyring(ecKey), opts)
+
+	grant := Grant{UserID: uuid.New(), Scopes: []string{"profile", "orders:read"}, AMR: []string{AMRPassword}}
+	pair, _, err := tm.GenerateTokenPair(grant)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() error = %v", err)
+	}
+	mfaToken, err := tm.GenerateMFAToken(grant, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken() error = %v", err)
+	}
+	expired, _, err := NewTokenManager(NewKeyring(ecKey), Options{AccessTTL: -time.Minute, Issuer: opts.Issuer, Audience: opts.Audience}).
+		GenerateTokenPair(grant)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() error = %v", err)
+	}
+	otherKey, _, err := NewTokenManager(NewKeyring(newTestECKey(t)), opts).GenerateTokenPair(grant)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() error = %v", err)
+	}
+	// Токен выпущен до появления iss и aud
+	legacy, _, err := NewTokenManager(NewKeyring(ecKey), Options{AccessTTL: time.Minute}).GenerateTokenPair(grant)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		verifier VerifierOptions
+		token    string
+		wantErr  error
+	}{
+		{
+			name:     "валидный access токен",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience},
+			token:    pair.AccessToken,
+		},
+		{
+			name:     "refresh токен вместо access",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience},
+			token:    pair.RefreshToken,
+			wantErr:  ErrNotAccessToken,
+		},
+		{
+			name:     "токен MFA challenge вместо access",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience},
+			token:    mfaToken,
+			wantErr:  ErrNotAccessToken,
+		},
+		{
+			name:     "истёкший токен",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience},
+			token:    expired.AccessToken,
+			wantErr:  ErrTokenExpired,
+		},
+		{
+			name:     "истёкший токен в пределах leeway",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience, Leeway: 2 * time.Minute},
+			token:    expired.AccessToken,
+		},
+		{
+			name:     "чужой issuer",
+			verifier: VerifierOptions{Issuer: "https://other.example.com"},
+			token:    pair.AccessToken,
+			wantErr:  ErrInvalidToken,
+		},
+		{
+			name:     "чужая audience",
+			verifier: VerifierOptions{Audience: "billing"},
+			token:    pair.AccessToken,
+			wantErr:  ErrInvalidToken,
+		},
+		{
+			name:     "токен без iss и aud до LegacyUntil",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience, LegacyUntil: time.Now().Add(time.Minute)},
+			token:    legacy.AccessToken,
+		},
+		{
+			name:     "токен без iss и aud после LegacyUntil",
+			verifier: VerifierOptions{Issuer: opts.Issuer, Audience: opts.Audience, LegacyUntil: time.Now().Add(-time.Second)},
+			token:    legacy.AccessToken,
+			wantErr:  ErrInvalidToken,
+		},
+		{
+			name:     "чужой issuer до LegacyUntil",
+			verifier: VerifierOptions{Issuer: "https://other.example.com", LegacyUntil: time.Now().Add(time.Minute)},
+			token:    pair.AccessToken,
+			wantErr:  ErrInvalidToken,
+		},
+		{
+			name:    "подписан неизвестным ключом",
+			token:   otherKey.AccessToken,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "испорченная подпись",
+			token:   pair.AccessToken[:len(pair.AccessToken)-4] + "AAAA",
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewAccessTokenVerifier(NewKeyring(&SigningKey{ID: ecKey.ID, Method: ecKey.Method, PublicKey: ecKey.PublicKey}), tt.verifier)
+
+			claims, err := verifier.ParseAccessToken(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseAccessToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if claims.UserID != grant.UserID || !claims.HasScope("orders:read") || !claims.HasAMR(AMRPassword) {
+				t.Fatalf("ParseAccessToken() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestLegacyTokenWithoutKidAfterRotation(t *testing.T) {
+	hmacKey := NewHMACKey("secret")
+	ecKey := newTestECKey(t)
+
+	// Токен выпущен до появления kid и token_use: тип определяется по UserID
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, TokenClaims{
+		UserID:           uuid.New(),
+		RefreshID:        uuid.NewString(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	legacy, err := token.SignedString(hmacKey.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenManager(NewKeyring(ecKey, hmacKey), Options{})
+	if _, err = tm.ParseAccessToken(legacy); err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if _, err = tm.ParseRefreshToken(legacy); !errors.Is(err, ErrNotRefreshToken) {
+		t.Fatalf("ParseRefreshToken() error = %v, want %v", err, ErrNotRefreshToken)
+	}
+}
+
+func TestParseRefreshToken(t *testing.T) {
+	keyring := NewKeyring(NewHMACKey("secret"))
+
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{name: "JWT", format: RefreshFormatJWT},
+		{name: "непрозрачный", format: RefreshFormatOpaque},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTokenManager(keyring, Options{AccessTTL: time.Minute, RefreshTTL: time.Hour, RefreshFormat: tt.format})
+
+			pair, refreshID, err := tm.GenerateTokenPair(Grant{UserID: uuid.New()})
+			if err != nil {
+				t.Fatalf("GenerateTokenPair() error = %v", err)
+			}
+			if got := isOpaqueToken(pair.RefreshToken); got != (tt.format == RefreshFormatOpaque) {
+				t.Fatalf("isOpaqueToken() = %v для формата %s", got, tt.format)
+			}
+
+			// Токен любого формата разбирается независимо от текущей настройки
+			for _, format := range []string{RefreshFormatJWT, RefreshFormatOpaque} {
+				parser := NewTokenManager(keyring, Options{RefreshFormat: format})
+
+				claims, err := parser.ParseRefreshToken(pair.RefreshToken)
+				if err != nil {
+					t.Fatalf("ParseRefreshToken() в режиме %s error = %v", format, err)
+				}
+				if claims.RefreshID != refreshID {
+					t.Fatalf("RefreshID = %s, want %s", claims.RefreshID, refreshID)
+				}
+			}
+
+			if _, err = tm.ParseRefreshToken(pair.AccessToken); !errors.Is(err, ErrNotRefreshToken) {
+				t.Fatalf("ParseRefreshToken(access) error = %v, want %v", err, ErrNotRefreshToken)
+			}
+		})
+	}
+}
+
+func TestIsOpaqueToken(t *testing.T) {
+	opaque, err := generateOpaqueRefreshToken(uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "непрозрачный токен", token: opaque, want: true},
+		{name: "короче на символ", token: opaque[1:]},
+		{name: "длиннее на символ", token: opaque + "A"},
+		{name: "с точкой", token: opaque[:10] + "." + opaque[11:]},
+		{name: "пустая строка"},
+		{name: "произвольная строка без точек", token: strings.Repeat("A", 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOpaqueToken(tt.token); got != tt.want {
+				t.Fatalf("isOpaqueToken(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOpaqueRefreshTokenRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "не base64url", token: strings.Repeat("*", opaqueTokenLength)},
+		{name: "другая длина", token: strings.Repeat("A", opaqueTokenLength-4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOpaqueRefreshToken(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("parseOpaqueRefreshToken() error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestMFATokenIsNotAccessToken(t *testing.T) {
+	tm := NewTokenManager(NewKeyring(NewHMACKey("secret")), Options{AccessTTL: time.Minute, RefreshTTL: time.Hour})
+
+	grant := Grant{UserID: uuid.New(), Scopes: []string{"profile"}, AMR: []string{AMRPassword}}
+	mfaToken, err := tm.GenerateMFAToken(grant, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken() error = %v", err)
+	}
+
+	claims, err := tm.ParseMFAToken(mfaToken)
+	if err != nil {
+		t.Fatalf("ParseMFAToken() error = %v", err)
+	}
+	if claims.UserID != grant.UserID || !claims.HasScope("profile") || claims.ID == "" {
+		t.Fatalf("ParseMFAToken() claims = %+v", claims)
+	}
+
+	pair, _, err := tm.GenerateTokenPair(grant)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() error = %v", err)
+	}
+	if _, err = tm.ParseMFAToken(pair.AccessToken); !errors.Is(err, ErrNotMFAToken) {
+		t.Fatalf("ParseMFAToken(access) error = %v, want %v", err, ErrNotMFAToken)
+	}
+}
+
+func TestAuthTime(t *testing.T) {
+	tm := NewTokenManager(NewKeyring(NewHMACKey("secret")), Options{AccessTTL: time.Minute, RefreshTTL: time.Hour})
+
+	tests := []struct {
+		name     string
+		authTime time.Time
+		maxAge   time.Duration
+		want     bool
+	}{
+		{name: "недавний вход", authTime: time.Now().Add(-time.Minute), maxAge: 5 * time.Minute, want: true},
+		{name: "давний вход", authTime: time.Now().Add(-time.Hour), maxAge: 5 * time.Minute},
+		{name: "без auth_time", maxAge: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, _, err := tm.GenerateTokenPair(Grant{UserID: uuid.New(), AuthTime: tt.authTime})
+			if err != nil {
+				t.Fatalf("GenerateTokenPair() error = %v", err)
+			}
+
+			claims, err := tm.ParseAccessToken(pair.AccessToken)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if (claims.AuthTime == nil) != tt.authTime.IsZero() {
+				t.Fatalf("AuthTime = %v, want %v", claims.AuthTime, tt.authTime)
+			}
+			if got := claims.AuthenticatedWithin(tt.maxAge); got != tt.want {
+				t.Fatalf("AuthenticatedWithin(%s) = %v, want %v", tt.maxAge, got, tt.want)
+			}
+		})
+	}
+}
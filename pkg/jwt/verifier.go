@@ -0,0 +1,107 @@
+package jwt
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet - источник ключей проверки подписи по kid: Keyring сервиса,
+// статический набор ключей или RemoteKeySet, загружаемый по JWKS URL
+type KeySet interface {
+	Lookup(kid string) (*SigningKey, bool)
+}
+
+type VerifierOptions struct {
+	Issuer   string        // ожидаемый iss, пустой - не проверяется
+	Audience string        // ожидаемый aud, пустой - не проверяется
+	Leeway   time.Duration // допустимое расхождение часов
+
+	// До LegacyUntil принимаются токены совсем без iss или aud: они выпущены до появления
+	// этих claims и ещё не истекли. Токен с чужим iss или aud отклоняется всегда
+	LegacyUntil time.Time
+}
+
+// AccessTokenVerifier проверяет access токены без возможности их выпускать.
+// Им пользуются и TokenManager, и сервисы-потребители, поэтому правила
+// проверки claims у них совпадают
+type AccessTokenVerifier struct {
+	keys        KeySet
+	issuer      string
+	audience    string
+	leeway      time.Duration
+	legacyUntil time.Time
+}
+
+func NewAccessTokenVerifier(keys KeySet, opts VerifierOptions) *AccessTokenVerifier {
+	return &AccessTokenVerifier{
+		keys:        keys,
+		issuer:      opts.Issuer,
+		audience:    opts.Audience,
+		leeway:      opts.Leeway,
+		legacyUntil: opts.LegacyUntil,
+	}
+}
+
+func (v *AccessTokenVerifier) ParseAccessToken(accessToken string) (*TokenClaims, error) {
+	claims, err := parseToken(v.keys, accessToken, v.leeway)
+	if err != nil {
+		return nil, err
+	}
+	if !v.validIssuer(claims) || !v.validAudience(claims) {
+		return nil, ErrInvalidToken
+	}
+	if !claims.isTokenUse(TokenUseAccess) {
+		return nil, ErrNotAccessToken
+	}
+
+	return claims, nil
+}
+
+// validIssuer сверяет iss с ожидаемым. Токен без iss принимается только до legacyUntil
+func (v *AccessTokenVerifier) validIssuer(claims *TokenClaims) bool {
+	if v.issuer == "" || claims.Issuer == v.issuer {
+		return true
+	}
+	return claims.Issuer == "" && time.Now().Before(v.legacyUntil)
+}
+
+// validAudience проверяет, что токен выпущен для ожидаемой aud. Токен без aud принимается только до legacyUntil
+func (v *AccessTokenVerifier) validAudience(claims *TokenClaims) bool {
+	if v.audience == "" || slices.Contains(claims.Audience, v.audience) {
+		return true
+	}
+	return len(claims.Audience) == 0 && time.Now().Before(v.legacyUntil)
+}
+
+// parseToken проверяет подпись ключом из keys по kid из заголовка токена и срок действия
+func parseToken(keys KeySet, tokenString string, leeway time.Duration, opts ...jwt.ParserOption) (*TokenClaims, error) {
+	opts = append(opts, jwt.WithLeeway(leeway), jwt.WithExpirationRequired())
+
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		return key.verifyKey(token)
+	}, opts...)
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*TokenClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
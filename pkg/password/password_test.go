@@ -0,0 +1,91 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "correct horse battery staple"
+
+	argonHash, err := Hash(secret)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(argonHash, "$")
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		wantErr  error
+	}{
+		{name: "argon2id", hash: argonHash, password: secret},
+		{name: "argon2id, неверный пароль", hash: argonHash, password: secret + "!", wantErr: ErrMismatch},
+		{name: "bcrypt", hash: string(bcryptHash), password: secret},
+		{name: "bcrypt, неверный пароль", hash: string(bcryptHash), password: secret + "!", wantErr: ErrMismatch},
+		{name: "bcrypt $2y$", hash: "$2y$" + strings.TrimPrefix(string(bcryptHash), "$2a$"), password: secret},
+		{name: "повреждённый bcrypt", hash: "$2a$04$short", password: secret, wantErr: ErrInvalidHash},
+		{name: "неизвестный алгоритм", hash: "$1$salt$hash", password: secret, wantErr: ErrUnsupportedHash},
+		{name: "пустой хеш", password: secret, wantErr: ErrUnsupportedHash},
+		{name: "argon2id без частей", hash: "$argon2id$v=19$m=65536,t=1,p=4$salt", password: secret, wantErr: ErrInvalidHash},
+		{name: "argon2id другой версии", hash: strings.Replace(argonHash, "v=19", "v=16", 1), password: secret, wantErr: ErrInvalidHash},
+		{name: "argon2id с невалидной солью", hash: strings.Replace(argonHash, parts[4], "!!", 1), password: secret, wantErr: ErrInvalidHash},
+		{name: "argon2id с пустым хешем", hash: strings.TrimSuffix(argonHash, parts[5]), password: secret, wantErr: ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.hash, tt.password); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashUsesRandomSalt(t *testing.T) {
+	first, err := Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	second, err := Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	if first == second {
+		t.Fatal("хеши одного пароля совпали: соль не случайная")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, err := Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{name: "argon2id с текущими параметрами", hash: current},
+		{name: "argon2id с устаревшими параметрами", hash: strings.Replace(current, "m=65536,t=1", "m=32768,t=3", 1), want: true},
+		{name: "bcrypt", hash: "$2a$10$abcdefghijklmnopqrstuu", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.hash); got != tt.want {
+				t.Fatalf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/medods/auth-service/internal/config"
+	"log/slog"
+	"mime"
 	"net/smtp"
 	"strings"
 )
@@ -16,15 +18,32 @@ func NewEmailSender(config *config.SMTPConfig) *EmailSender {
 	return &EmailSender{config: config}
 }
 
+// SendAlert отправляет служебное уведомление на адрес отправителя SMTP_FROM
 func (s *EmailSender) SendAlert(subject, body string) error {
+	return s.SendEmail(s.config.From, subject, body)
+}
+
+// SendEmail отправляет письмо пользователю
+func (s *EmailSender) SendEmail(to, subject, body string) error {
+	const op = "smtp.SendEmail"
+
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("недопустимый адрес получателя")
+	}
+
+	// Без SMTP письмо только логируется. Тело с одноразовыми ссылками и кодами выводится лишь по SMTP_DEBUG_BODY
 	if s.config.Username == "" || s.config.Password == "" {
-		fmt.Printf("\n=== Email Alert ===\nSubject: %s\nBody: %s\n==================\n", subject, body)
+		slog.Info(op, "SMTP не настроен, письмо не отправлено", slog.String("to", to), slog.String("subject", subject))
+		if s.config.DebugBody {
+			fmt.Printf("\n=== Email ===\nTo: %s\nSubject: %s\nBody: %s\n==================\n", to, subject, body)
+		}
 		return nil
 	}
 
 	headers := make([]string, 0)
 	headers = append(headers, fmt.Sprintf("From: %s", s.config.From))
-	headers = append(headers, fmt.Sprintf("Subject: %s", subject))
+	headers = append(headers, fmt.Sprintf("To: %s", to))
+	headers = append(headers, fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", subject)))
 	headers = append(headers, "MIME-Version: 1.0")
 	headers = append(headers, "Content-Type: text/plain; charset=utf-8")
 
@@ -60,7 +79,7 @@ func (s *EmailSender) SendAlert(subject, body string) error {
 			return fmt.Errorf("ошибка при указании отправителя: %w", err)
 		}
 
-		if err = c.Rcpt(s.config.From); err != nil {
+		if err = c.Rcpt(to); err != nil {
 			return fmt.Errorf("ошибка при указании получателя: %w", err)
 		}
 
@@ -76,7 +95,7 @@ func (s *EmailSender) SendAlert(subject, body string) error {
 		}
 	} else {
 		// Отправляем без TLS
-		err := smtp.SendMail(addr, auth, s.config.From, []string{s.config.From}, []byte(message))
+		err := smtp.SendMail(addr, auth, s.config.From, []string{to}, []byte(message))
 		if err != nil {
 			return fmt.Errorf("ошибка при отправке письма: %w", err)
 		}
@@ -0,0 +1,111 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет "12345678901234567890" из тестовых векторов RFC 6238 (приложение B) в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// Шестизначные коды - младшие разряды восьмизначных кодов SHA1 из RFC 6238
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatalf("Code() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Code() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current, _ := Code(rfcSecret, now)
+	previous, _ := Code(rfcSecret, now.Add(-Period))
+	stale, _ := Code(rfcSecret, now.Add(-2*Period))
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "текущий код", secret: rfcSecret, code: current, wantStep: step(now), wantOK: true},
+		{name: "код с пробелом", secret: rfcSecret, code: current[:3] + " " + current[3:], wantStep: step(now), wantOK: true},
+		{name: "секрет в нижнем регистре", secret: strings.ToLower(rfcSecret), code: current, wantStep: step(now), wantOK: true},
+		{name: "предыдущий шаг в пределах skew", secret: rfcSecret, code: previous, skew: 1, wantStep: step(now) - 1, wantOK: true},
+		{name: "предыдущий шаг без skew", secret: rfcSecret, code: previous},
+		{name: "код двухшаговой давности", secret: rfcSecret, code: stale, skew: 1},
+		{name: "неверный код", secret: rfcSecret, code: "000000", skew: 1},
+		{name: "короткий код", secret: rfcSecret, code: current[:5], skew: 1},
+		{name: "невалидный секрет", secret: "1!", code: current, skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := Validate(tt.secret, tt.code, now, tt.skew)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Fatalf("Validate() = %d, %v, want %d, %v", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		t.Fatalf("decodeSecret() error = %v", err)
+	}
+	if len(key) != secretSize {
+		t.Fatalf("длина секрета = %d байт, want %d", len(key), secretSize)
+	}
+
+	other, _ := GenerateSecret()
+	if other == secret {
+		t.Fatal("GenerateSecret() вернул один и тот же секрет дважды")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Auth Service", "user@example.com", rfcSecret))
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Auth Service:user@example.com" {
+		t.Fatalf("URI() = %s", uri)
+	}
+
+	query := uri.Query()
+	for key, want := range map[string]string{"secret": rfcSecret, "issuer": "Auth Service", "digits": "6", "period": "30"} {
+		if got := query.Get(key); got != want {
+			t.Fatalf("параметр %s = %q, want %q", key, got, want)
+		}
+	}
+}